@@ -1,28 +1,33 @@
 package api
 
+import "context"
 
 // The API instance
 var APIImpl API
 
 // API abstract type
 type API interface {
-	Login(email, password string) error
+	Login(ctx context.Context, email, password string) error
 	Endpoint() string
 	Host() string
 	Key() string
 	SetKey(token string)
-	AutoUpdateStepsBest(projectSlug string, revision string) (dfiles []DependencyFile, err error)
-	AutoUpdateStepsNext(projectSlug string, revision string) (updateSet *UpdateSet, err error)
-	AutoUpdateStepsPush(revision string, rs *UpdateSetResult) (err error)
-	DependencyAlertsGet(p *Project) (alerts []Alert, err error)
-	DependencyFilesPush(projectSlug string, dfiles []*DependencyFile) (jsonResp map[string][]DependencyFile, err error)
-	LiveEvalStart(requestDeps map[string][]*DependencyFile) (jsonResp map[string]interface{}, err error)
-	LiveEvalGetResponse(jobId interface{}) (response LiveEvalResponse, body []byte, err error)
-	ProjectList(privateOnly bool) (owner2Project map[string][]Project, err error)
-	ProjectUpdate(p *Project, update map[string]interface{}) (err error)
-	ProjectCreate(p *Project) (jsonResp map[string]interface{}, err error)
-	ProjectSync(p *Project) (err error)
-	ProjectFetch(p *Project) (err error)
-	ProjectGetDependencies(p *Project) (deps []Dependency, err error)
-	ProjectGetDependencyFiles(p *Project) (dfiles []DependencyFile, err error)
+	Version() int
+	Supports(feature Feature) bool
+	AutoUpdateStepsBest(ctx context.Context, projectSlug string, revision string) (dfiles []DependencyFile, err error)
+	AutoUpdateStepsNext(ctx context.Context, projectSlug string, revision string) (updateSet *UpdateSet, err error)
+	AutoUpdateStepsPush(ctx context.Context, revision string, rs *UpdateSetResult) (err error)
+	DependencyAlertsGet(ctx context.Context, p *Project) (alerts []Alert, err error)
+	DependencyFilesPush(ctx context.Context, projectSlug string, dfiles []*DependencyFile) (result *PushResult, err error)
+	LiveEvalStart(ctx context.Context, requestDeps map[string][]*DependencyFile) (jsonResp map[string]interface{}, err error)
+	LiveEvalGetResponse(ctx context.Context, jobId interface{}) (response LiveEvalResponse, body []byte, err error)
+	ProjectList(ctx context.Context, privateOnly bool) (owner2Project map[string][]Project, err error)
+	ProjectUpdate(ctx context.Context, p *Project, update map[string]interface{}) (err error)
+	ProjectCreate(ctx context.Context, p *Project) (jsonResp map[string]interface{}, err error)
+	ProjectSync(ctx context.Context, p *Project) (err error)
+	ProjectFetch(ctx context.Context, p *Project) (err error)
+	ProjectGetDependencies(ctx context.Context, p *Project) (deps []Dependency, err error)
+	ProjectGetDependencyFiles(ctx context.Context, p *Project) (dfiles []DependencyFile, err error)
+	User(ctx context.Context) (user User, err error)
+	UserTeams(ctx context.Context) (teams []Team, err error)
 }
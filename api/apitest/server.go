@@ -0,0 +1,552 @@
+// Package apitest provides a fake Gemnasium API server, for testing the
+// toolbelt (or any tool built on top of it) offline.
+//
+// The server implements the endpoints of API v1 and v2 used by api.APIv1 and
+// api.APIv2, backed by an in-memory state that tests can set up and inspect:
+//
+//	srv := apitest.NewServer(1)
+//	defer srv.Close()
+//	srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah"}})
+//	api.APIImpl = api.NewAPIv1(srv.URL, srv.APIKey)
+package apitest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gemnasium/toolbelt/api"
+)
+
+const (
+	DefaultAPIKey   = "abcdef123456"
+	DefaultEmail    = "batman@example.com"
+	DefaultPassword = "secret123"
+	DefaultTeam     = "batcave"
+)
+
+// Project is the server side state of a project
+type Project struct {
+	api.Project
+	// Owner of the project. Projects owned by the current user are listed
+	// under "owned" by v1. Defaults to "owned".
+	Owner string
+	// Slug of the team the project belongs to (v2 only).
+	// Defaults to DefaultTeam.
+	Team            string
+	Dependencies    []api.Dependency
+	DependencyFiles []api.DependencyFile
+	Alerts          []api.Alert
+	// Update sets served in turn by auto_update_steps/next
+	UpdateSets []api.UpdateSet
+	// Results pushed for the update sets
+	UpdateSetResults []api.UpdateSetResult
+	// Dependency files served by auto_update_steps/best
+	BestDependencyFiles []api.DependencyFile
+	// Number of calls to the sync endpoint
+	SyncCount int
+}
+
+// EvalJob is a live evaluation job, created by POST /evaluate
+type EvalJob struct {
+	ID              string
+	DependencyFiles []api.DependencyFile
+	// Number of polls left before the job is done
+	PendingPolls int
+}
+
+// Server is a fake Gemnasium API server. All the fields can be set before
+// running requests against the server, and inspected afterwards. Use Lock
+// and Unlock when accessing them while requests may be running.
+type Server struct {
+	*httptest.Server
+	sync.Mutex
+
+	Version  int    // API version, 1 or 2
+	APIKey   string // Expected API key
+	Email    string // Login email
+	Password string // Login password
+	User     api.V2User
+	Teams    []api.V2Team
+	Projects map[string]*Project
+
+	// Number of polls returning "working" before an evaluation is done
+	EvalPolls int
+	// Result of the live evaluations
+	EvalResult api.LiveEvalResponse
+	EvalJobs   map[string]*EvalJob
+
+	// Requests received by the server, like "GET /projects/blah"
+	Requests []string
+
+	jwt string
+	seq int
+}
+
+// Start a new fake server, implementing the given API version (1 or 2)
+func NewServer(version int) *Server {
+	s := &Server{
+		Version:  version,
+		APIKey:   DefaultAPIKey,
+		Email:    DefaultEmail,
+		Password: DefaultPassword,
+		User: api.V2User{
+			Name:   "Bruce Wayne",
+			Email:  DefaultEmail,
+			APIKey: DefaultAPIKey,
+		},
+		Projects: map[string]*Project{},
+		EvalJobs: map[string]*EvalJob{},
+		jwt:      "fake.jwt.token",
+	}
+	s.Teams = []api.V2Team{{Slug: DefaultTeam, Owner: s.User}}
+	s.EvalResult.Status = "done"
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Add a project to the server state, and return it
+func (s *Server) AddProject(p *Project) *Project {
+	s.Lock()
+	defer s.Unlock()
+	if p.Owner == "" {
+		p.Owner = "owned"
+	}
+	if p.Team == "" {
+		p.Team = DefaultTeam
+	}
+	if p.Monitored == nil {
+		p.Monitored = boolPtr(true)
+	}
+	s.Projects[p.Slug] = p
+	return p
+}
+
+// Return the project with the given slug, or nil
+func (s *Server) Project(slug string) *Project {
+	s.Lock()
+	defer s.Unlock()
+	return s.Projects[slug]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.Requests = append(s.Requests, r.Method+" "+r.URL.Path)
+
+	path := strings.Trim(r.URL.Path, "/")
+	if r.Method == "POST" && path == "login" {
+		s.login(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Invalid API Key")
+		return
+	}
+	segments := strings.Split(path, "/")
+	switch {
+	case segments[0] == "user" && s.Version == 2:
+		s.serveUser(w, r, segments[1:])
+	case segments[0] == "teams" && s.Version == 2 && len(segments) == 3 && segments[2] == "projects" && r.Method == "POST":
+		s.createProject(w, r, segments[1])
+	case segments[0] == "projects" && len(segments) == 1 && s.Version == 1:
+		switch r.Method {
+		case "GET":
+			s.listProjects(w)
+		case "POST":
+			s.createProject(w, r, DefaultTeam)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	case segments[0] == "projects" && len(segments) > 1:
+		p, ok := s.Projects[segments[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		s.serveProject(w, r, p, segments[2:])
+	case segments[0] == "evaluate":
+		s.serveEvaluate(w, r, segments[1:])
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// Basic auth with the API key, or the JWT returned on login for v2
+func (s *Server) authorized(r *http.Request) bool {
+	if _, key, ok := r.BasicAuth(); ok {
+		return key == s.APIKey
+	}
+	return s.Version == 2 && r.Header.Get("Authorization") == "Bearer "+s.jwt
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var credentials struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if credentials.Email != s.Email || credentials.Password != s.Password {
+		writeError(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+	if s.Version == 2 {
+		writeJSON(w, http.StatusOK, map[string]string{"jwt": s.jwt})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"api_token": s.APIKey})
+}
+
+func (s *Server) serveUser(w http.ResponseWriter, r *http.Request, segments []string) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	switch strings.Join(segments, "/") {
+	case "":
+		writeJSON(w, http.StatusOK, s.User)
+	case "teams":
+		writeJSON(w, http.StatusOK, s.Teams)
+	case "projects":
+		projects := []api.V2Project{}
+		for _, p := range s.sortedProjects() {
+			projects = append(projects, s.v2Project(p))
+		}
+		writeJSON(w, http.StatusOK, projects)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) listProjects(w http.ResponseWriter) {
+	owner2Project := map[string][]api.Project{}
+	for _, p := range s.sortedProjects() {
+		owner2Project[p.Owner] = append(owner2Project[p.Owner], p.Project)
+	}
+	writeJSON(w, http.StatusOK, owner2Project)
+}
+
+func (s *Server) createProject(w http.ResponseWriter, r *http.Request, team string) {
+	var p api.Project
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if p.Name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Name can't be blank")
+		return
+	}
+	if s.Version == 2 && s.team(team) == nil {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	s.seq++
+	p.Slug = fmt.Sprintf("%s-%d", strings.ToLower(strings.Replace(p.Name, " ", "-", -1)), s.seq)
+	p.Monitored = boolPtr(true)
+	s.Projects[p.Slug] = &Project{Project: p, Owner: "owned", Team: team}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":                 p.Name,
+		"slug":                 p.Slug,
+		"remaining_slot_count": 42,
+	})
+}
+
+func (s *Server) serveProject(w http.ResponseWriter, r *http.Request, p *Project, segments []string) {
+	if len(segments) > 0 && segments[0] == "revisions" {
+		s.serveAutoUpdate(w, r, p, segments[1:])
+		return
+	}
+	switch r.Method + " " + strings.Join(segments, "/") {
+	case "GET ":
+		if s.Version == 2 {
+			writeJSON(w, http.StatusOK, s.v2Project(p))
+			return
+		}
+		writeJSON(w, http.StatusOK, p.Project)
+	case "PATCH ":
+		s.updateProject(w, r, p)
+	case "POST sync":
+		p.SyncCount++
+		w.WriteHeader(http.StatusNoContent)
+	case "GET dependencies":
+		writeJSON(w, http.StatusOK, nonNil(p.Dependencies))
+	case "GET alerts":
+		if s.Version == 2 {
+			alerts := []interface{}{}
+			for _, a := range p.Alerts {
+				alerts = append(alerts, v2Alert(a))
+			}
+			writeJSON(w, http.StatusOK, alerts)
+			return
+		}
+		writeJSON(w, http.StatusOK, nonNil(p.Alerts))
+	case "GET dependency_files":
+		if s.Version == 2 {
+			dfiles := []api.V2DependencyFile{}
+			for _, df := range p.DependencyFiles {
+				content := base64.StdEncoding.EncodeToString(df.Content)
+				dfiles = append(dfiles, api.V2DependencyFile{Path: df.Path, SHA: df.SHA, Content: content})
+			}
+			writeJSON(w, http.StatusOK, dfiles)
+			return
+		}
+		writeJSON(w, http.StatusOK, nonNil(p.DependencyFiles))
+	case "POST dependency_files":
+		s.pushDependencyFiles(w, r, p)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) updateProject(w http.ResponseWriter, r *http.Request, p *Project) {
+	var update map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for k, v := range update {
+		switch k {
+		case "name":
+			p.Name, _ = v.(string)
+		case "desc", "description":
+			p.Description, _ = v.(string)
+		case "monitored":
+			if s.Version == 2 {
+				writeError(w, http.StatusUnprocessableEntity, "Unknown attribute: monitored")
+				return
+			}
+			monitored, _ := v.(bool)
+			p.Monitored = &monitored
+		default:
+			writeError(w, http.StatusUnprocessableEntity, "Unknown attribute: "+k)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Dependency files are pushed with their content as is with v1, and base64
+// encoded with v2
+func (s *Server) pushDependencyFiles(w http.ResponseWriter, r *http.Request, p *Project) {
+	var dfiles []api.DependencyFile
+	if s.Version == 2 {
+		var v2dfiles []api.V2DependencyFile
+		if err := json.NewDecoder(r.Body).Decode(&v2dfiles); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, v2df := range v2dfiles {
+			content, err := base64.StdEncoding.DecodeString(v2df.Content)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			dfiles = append(dfiles, api.DependencyFile{Path: v2df.Path, SHA: v2df.SHA, Content: content})
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&dfiles); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := map[string][]api.DependencyFile{"added": {}, "updated": {}, "unchanged": {}, "unsupported": {}}
+	for _, df := range dfiles {
+		status := "added"
+		for i, existing := range p.DependencyFiles {
+			if existing.Path != df.Path {
+				continue
+			}
+			if existing.SHA == df.SHA {
+				status = "unchanged"
+			} else {
+				status = "updated"
+				p.DependencyFiles[i] = df
+			}
+			break
+		}
+		if status == "added" {
+			p.DependencyFiles = append(p.DependencyFiles, df)
+		}
+		result[status] = append(result[status], df)
+	}
+
+	if s.Version == 2 {
+		p.CommitSHA = r.Header.Get("X-Gms-Revision")
+		p.Branch = r.Header.Get("X-Gms-Branch")
+		writeJSON(w, http.StatusOK, api.V2Commit{Branch: p.Branch, CommitSHA: p.CommitSHA})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Routes under /projects/{slug}/revisions/{revision}/auto_update_steps
+func (s *Server) serveAutoUpdate(w http.ResponseWriter, r *http.Request, p *Project, segments []string) {
+	if len(segments) != 3 || segments[1] != "auto_update_steps" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	switch r.Method + " " + segments[2] {
+	case "GET best":
+		writeJSON(w, http.StatusOK, nonNil(p.BestDependencyFiles))
+	case "POST next":
+		if len(p.UpdateSets) == 0 {
+			writeJSON(w, http.StatusOK, map[string]interface{}{})
+			return
+		}
+		var next api.UpdateSet
+		next, p.UpdateSets = p.UpdateSets[0], p.UpdateSets[1:]
+		writeJSON(w, http.StatusOK, next)
+	default:
+		id, err := strconv.Atoi(segments[2])
+		if err != nil || r.Method != "PATCH" {
+			writeError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		var result api.UpdateSetResult
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		result.UpdateSetID = id
+		result.ProjectSlug = p.Slug
+		p.UpdateSetResults = append(p.UpdateSetResults, result)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) serveEvaluate(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case r.Method == "POST" && len(segments) == 0:
+		var request map[string][]api.DependencyFile
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.seq++
+		job := &EvalJob{
+			ID:              strconv.Itoa(s.seq),
+			DependencyFiles: request["dependency_files"],
+			PendingPolls:    s.EvalPolls,
+		}
+		s.EvalJobs[job.ID] = job
+		writeJSON(w, http.StatusOK, map[string]string{"job_id": job.ID})
+	case r.Method == "GET" && len(segments) == 1:
+		job, ok := s.EvalJobs[segments[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		if job.PendingPolls > 0 {
+			job.PendingPolls--
+			writeJSON(w, http.StatusOK, map[string]string{"status": "working"})
+			return
+		}
+		writeJSON(w, http.StatusOK, s.EvalResult)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) sortedProjects() []*Project {
+	projects := []*Project{}
+	for _, p := range s.Projects {
+		projects = append(projects, p)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Slug < projects[j].Slug })
+	return projects
+}
+
+func (s *Server) team(slug string) *api.V2Team {
+	for i := range s.Teams {
+		if s.Teams[i].Slug == slug {
+			return &s.Teams[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) v2Project(p *Project) api.V2Project {
+	v2p := api.V2Project{
+		Basename:     p.Slug,
+		Color:        p.Color,
+		LatestCommit: api.V2Commit{Branch: p.Branch, CommitSHA: p.CommitSHA},
+		Description:  p.Description,
+		Manageable:   true,
+		Name:         p.Name,
+		Origin:       p.Origin,
+		Private:      p.Private,
+		Slug:         p.Slug,
+		Syncable:     true,
+	}
+	if team := s.team(p.Team); team != nil {
+		v2p.Team = *team
+	}
+	return v2p
+}
+
+// Alerts are encoded by hand, since the advisory date is a plain date with v2
+func v2Alert(a api.Alert) interface{} {
+	identifier := a.Advisory.Identifier
+	if identifier == "" {
+		identifier = strconv.Itoa(a.Advisory.ID)
+	}
+	date := a.Advisory.Date
+	if date.IsZero() {
+		date = a.OpenAt
+	}
+	return map[string]interface{}{
+		"advisory": map[string]interface{}{
+			"identifier":     identifier,
+			"date":           date.Format("2006-01-02"),
+			"title":          a.Advisory.Title,
+			"description":    a.Advisory.Description,
+			"solution":       a.Advisory.Solution,
+			"affected_range": a.Advisory.AffectedVersions,
+			"credit":         a.Advisory.Credits,
+			"urls":           a.Advisory.Links,
+			"package_slug":   a.Advisory.Package.Slug,
+		},
+		"status": a.Status,
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// Encode nil slices as empty JSON arrays
+func nonNil(v interface{}) interface{} {
+	switch s := v.(type) {
+	case []api.Dependency:
+		if s == nil {
+			return []api.Dependency{}
+		}
+	case []api.Alert:
+		if s == nil {
+			return []api.Alert{}
+		}
+	case []api.DependencyFile:
+		if s == nil {
+			return []api.DependencyFile{}
+		}
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// cache is an on-disk cache of the responses to GET requests, used for the
+// read endpoints called in loops (project, dependencies, dependency files,
+// alerts). Responses younger than ttl are used without calling the API.
+// Older ones are revalidated with a conditional request (If-None-Match,
+// If-Modified-Since), and used again if the API answers 304 Not Modified.
+// Entries are stored per endpoint and API key, and the entries of an
+// account are dropped as soon as it modifies something (POST, PATCH).
+type cache struct {
+	dir string
+	ttl time.Duration
+}
+
+type cacheEntry struct {
+	URI          string          `json:"uri"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	StoredAt     time.Time       `json:"stored_at"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// Lambda to be overriden in tests
+var now = time.Now
+
+// Return the cache set in the config file or env vars, or nil if the cache
+// is disabled.
+func newCache() *cache {
+	dir := cacheDir()
+	if dir == "" {
+		return nil
+	}
+	return &cache{dir: dir, ttl: config.CacheTTL}
+}
+
+// Return the directory of the on-disk caches, or "" if caching is disabled.
+// Recording and replaying API calls bypass the caches, so that all the calls
+// are recorded, and replayed in the same order.
+func cacheDir() string {
+	if config.NoCache || config.RecordDir != "" || config.ReplayDir != "" {
+		return ""
+	}
+	if config.CacheDir != "" {
+		return config.CacheDir
+	}
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userCacheDir, "gemnasium")
+}
+
+// Directory of the entries of the account using key on endpoint.
+// The API key is hashed, it never appears in clear in the cache.
+func (c *cache) accountDir(endpoint, key string) string {
+	return filepath.Join(c.dir, hash(endpoint+"\n"+key))
+}
+
+func (c *cache) path(endpoint, key, uri string) string {
+	return filepath.Join(c.accountDir(endpoint, key), hash(uri)+".json")
+}
+
+// Return the entry stored for uri, or nil. Unreadable entries are ignored.
+func (c *cache) get(endpoint, key, uri string) *cacheEntry {
+	if c == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(c.path(endpoint, key, uri))
+	if err != nil {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.URI != uri {
+		return nil
+	}
+	return entry
+}
+
+// Store the response to a GET on uri. Errors are ignored, the cache being
+// an optimization only.
+func (c *cache) put(endpoint, key, uri string, resp *http.Response, body []byte) {
+	if c == nil || !json.Valid(body) {
+		return
+	}
+	c.save(endpoint, key, &cacheEntry{
+		URI:          uri,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         body,
+	})
+}
+
+// Mark entry as fresh again, after the API told it's not modified
+func (c *cache) touch(endpoint, key string, entry *cacheEntry) {
+	if c == nil {
+		return
+	}
+	c.save(endpoint, key, entry)
+}
+
+func (c *cache) save(endpoint, key string, entry *cacheEntry) {
+	entry.StoredAt = now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	writeFileAtomic(c.path(endpoint, key, entry.URI), data)
+}
+
+// Write data to path, through a temp file: concurrent runs must not read
+// half a file. Errors are ignored, caches being an optimization only.
+func writeFileAtomic(path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Drop all the entries of an account
+func (c *cache) clear(endpoint, key string) {
+	if c == nil {
+		return
+	}
+	os.RemoveAll(c.accountDir(endpoint, key))
+}
+
+// Return true if entry can be used without asking the API
+func (c *cache) fresh(entry *cacheEntry) bool {
+	return now().Sub(entry.StoredAt) < c.ttl
+}
+
+// Make req conditional, so that the API answers 304 if entry is still valid
+func (e *cacheEntry) setConditions(req *http.Request) {
+	if e == nil {
+		return
+	}
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/gemnasium/toolbelt/config/configtest"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(configtest.Run(m))
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("If-None-Match"))
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"slug": "blah", "name": "Blah"}`))
+	}))
+	defer ts.Close()
+
+	clock := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	orgNow := now
+	now = func() time.Time { return clock }
+	defer func() { now = orgNow }()
+
+	a := NewAPIv1(ts.URL, "secret-api-key")
+	a.cache = &cache{dir: dir, ttl: time.Minute}
+	fetch := func() {
+		p := &Project{Slug: "blah"}
+		if err := a.ProjectFetch(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != "Blah" {
+			t.Errorf("Expected project name to be 'Blah', got '%s'", p.Name)
+		}
+	}
+
+	fetch()
+	fetch() // fresh, the API is not called
+	clock = clock.Add(2 * time.Minute)
+	fetch() // stale, revalidated
+	fetch() // fresh again
+	if err := a.ProjectSync(context.Background(), &Project{Slug: "blah"}); err != nil {
+		t.Fatal(err)
+	}
+	fetch() // cleared by the sync
+
+	expected := []string{
+		"GET /projects/blah ",
+		`GET /projects/blah "v1"`,
+		"POST /projects/blah/sync ",
+		"GET /projects/blah ",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Expected requests:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(requests, "\n"))
+	}
+
+	// Another API key has its own entries
+	a.SetKey("other-api-key")
+	fetch()
+	if len(requests) != 5 {
+		t.Errorf("Entries of other API keys should not be used")
+	}
+
+	// The API key is never stored in clear
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if strings.Contains(path+string(data), "secret-api-key") {
+			t.Errorf("API key found in cache: %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewCacheDisabled(t *testing.T) {
+	orgNoCache, orgReplayDir := config.NoCache, config.ReplayDir
+	defer func() { config.NoCache, config.ReplayDir = orgNoCache, orgReplayDir }()
+
+	orgCacheDir := config.CacheDir
+	defer func() { config.CacheDir = orgCacheDir }()
+	config.NoCache = false
+	config.CacheDir = "/tmp/gemnasium-test-cache"
+	if c := newCache(); c == nil || c.dir != "/tmp/gemnasium-test-cache" {
+		t.Errorf("Expected cache in /tmp/gemnasium-test-cache, got %+v", c)
+	}
+	config.ReplayDir = "/tmp/recording"
+	if newCache() != nil {
+		t.Error("Cache should be disabled when replaying")
+	}
+	config.ReplayDir = ""
+	config.NoCache = true
+	if newCache() != nil {
+		t.Error("Cache should be disabled with --no-cache")
+	}
+}
+
+// Cached models are decoded again from JSON
+func TestModelsJSONRoundTrip(t *testing.T) {
+	models := []interface{}{
+		&Project{Name: "Blah", Slug: "blah", CommitSHA: "abcdef"},
+		&[]Dependency{{Requirement: ">=1.0", LockedVersion: "1.2", Package: Package{Name: "rails"}, Advisories: []Advisory{{ID: 1}}}},
+		&[]DependencyFile{{Path: "Gemfile", SHA: "sha", Content: []byte("gem 'rails'")}},
+		&[]Alert{{Advisory: Advisory{ID: 1, Identifier: "CVE-2014-1234"}, OpenAt: time.Date(2014, 4, 25, 10, 0, 0, 0, time.UTC), Status: "open"}},
+		&[]V2Alert{{Advisory: V2Advisory{Identifier: "CVE-2014-1234", Date: V2AdvisoryDate(time.Date(2014, 4, 25, 0, 0, 0, 0, time.UTC))}, Status: "open"}},
+		&V2Project{Slug: "blah", Team: V2Team{Slug: "team", Owner: V2User{Name: "Bruce"}}},
+	}
+	for _, model := range models {
+		data, err := json.Marshal(model)
+		if err != nil {
+			t.Fatalf("%T: %s", model, err)
+		}
+		decoded := reflect.New(reflect.TypeOf(model).Elem()).Interface()
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("%T: %s", model, err)
+		}
+		if !reflect.DeepEqual(model, decoded) {
+			t.Errorf("%T doesn't round-trip through JSON: %+v, got %+v", model, model, decoded)
+		}
+	}
+}
+
+func TestV2AdvisoryDateMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(V2AdvisoryDate(time.Date(2014, 4, 25, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"2014-04-25"` {
+		t.Errorf(`Expected "2014-04-25", got %s`, data)
+	}
+}
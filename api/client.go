@@ -0,0 +1,116 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// Return the HTTP client used for all the calls to the API.
+// Each call (including the response body) must complete within
+// config.Timeout, unless it is 0.
+// Calls are recorded in config.RecordDir, or replayed from config.ReplayDir
+// when set, and traced on stderr in debug mode.
+func newHTTPClient() *http.Client {
+	transport, err := sharedTransport()
+	if err != nil {
+		transport = errTransport{err}
+	}
+	switch {
+	case config.ReplayDir != "":
+		transport = newReplayer(config.ReplayDir)
+	case config.RecordDir != "":
+		transport = newRecorder(config.RecordDir, transport)
+	}
+	if config.Debug {
+		transport = &tracer{transport: transport}
+	}
+	return &http.Client{Timeout: config.Timeout, Transport: transport}
+}
+
+// The transport shared by all the API clients, so that connections are
+// reused. It's built again if the TLS or proxy settings change.
+var (
+	transportMu       sync.Mutex
+	transport         http.RoundTripper
+	transportErr      error
+	transportSettings string
+)
+
+func sharedTransport() (http.RoundTripper, error) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	settings := fmt.Sprintf("%q %q %q %v %q", config.CAFile, config.ClientCert, config.ClientKey, config.InsecureSkipVerify, config.ProxyURL)
+	if transport == nil && transportErr == nil || settings != transportSettings {
+		transport, transportErr = newTransport()
+		transportSettings = settings
+	}
+	return transport, transportErr
+}
+
+// Return a transport using the CA bundle, client certificate and proxy set
+// in the config file or env vars
+func newTransport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %s", err)
+		}
+		// Trust the system CAs too, the bundle may hold intermediates only
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file: no PEM certificate found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCert != "" || config.ClientKey != "" {
+		if config.ClientCert == "" || config.ClientKey == "" {
+			return nil, errors.New("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("client_cert: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsConfig
+
+	if config.ProxyURL != "" {
+		proxy, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("proxy_url: %s", err)
+		}
+		if proxy.Host == "" {
+			return nil, fmt.Errorf("proxy_url: missing host in %s", config.ProxyURL)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	return t, nil
+}
+
+// errTransport fails all the requests with err. The transport errors are
+// returned on the first request, as API constructors don't return errors.
+type errTransport struct {
+	err error
+}
+
+func (t errTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
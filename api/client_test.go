@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	orgTimeout := config.Timeout
+	config.Timeout = 10 * time.Millisecond
+	defer func() { config.Timeout = orgTimeout }()
+
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{}
+	start := time.Now()
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err == nil {
+		t.Error("ProjectFetch should time out")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("ProjectFetch should have timed out after 10ms, took %s", time.Since(start))
+	}
+}
+
+// Reset the TLS and proxy settings at the end of the test
+func resetTransportSettings(t *testing.T) {
+	t.Cleanup(func() {
+		config.CAFile, config.ClientCert, config.ClientKey = "", "", ""
+		config.InsecureSkipVerify = false
+		config.ProxyURL = ""
+	})
+}
+
+// Write der in dir as a PEM block, and return its path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCAFile(t *testing.T) {
+	resetTransportSettings(t)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"slug": "blah", "name": "Blah"}`))
+	}))
+	defer ts.Close()
+
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{}
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err == nil {
+		t.Error("Certificates signed by unknown CAs should be rejected")
+	}
+
+	dir := t.TempDir()
+	config.CAFile = writePEM(t, dir, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+	a = NewAPIv1(ts.URL, "")
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err != nil {
+		t.Errorf("Certificate signed by the CA of ca_file should be accepted: %s", err)
+	}
+
+	config.CAFile = filepath.Join(dir, "missing.pem")
+	a = NewAPIv1(ts.URL, "")
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err == nil || !strings.Contains(err.Error(), "ca_file") {
+		t.Errorf("Expected a ca_file error, got %v", err)
+	}
+
+	config.CAFile = ""
+	config.InsecureSkipVerify = true
+	a = NewAPIv1(ts.URL, "")
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err != nil {
+		t.Errorf("Certificate should not be verified: %s", err)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	resetTransportSettings(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "toolbelt"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"slug": "blah", "name": "Blah"}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir := t.TempDir()
+	config.CAFile = writePEM(t, dir, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{}
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err == nil {
+		t.Error("Calls without client certificate should be rejected")
+	}
+
+	config.ClientCert = writePEM(t, dir, "client.pem", "CERTIFICATE", der)
+	config.ClientKey = writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+	a = NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{}
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err != nil {
+		t.Errorf("Calls with client certificate should be accepted: %s", err)
+	}
+
+	config.ClientKey = ""
+	a = NewAPIv1(ts.URL, "")
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err == nil || !strings.Contains(err.Error(), "client_key") {
+		t.Errorf("Expected a client_key error, got %v", err)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	resetTransportSettings(t)
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.Method+" "+r.URL.String())
+		if r.URL.Path == "/login" {
+			w.Write([]byte(`{"api_token": "new-api-key"}`))
+			return
+		}
+		w.Write([]byte(`{"status": "done"}`))
+	}))
+	defer proxy.Close()
+
+	config.ProxyURL = proxy.URL
+	a := NewAPIv1("http://gemnasium.example.com", "")
+	a.retry = RetryPolicy{}
+	if err := a.Login(context.Background(), "bruce@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.LiveEvalGetResponse(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"POST http://gemnasium.example.com/login",
+		"GET http://gemnasium.example.com/evaluate/1",
+	}
+	if !reflect.DeepEqual(proxied, expected) {
+		t.Errorf("Expected calls through the proxy: %v, got %v", expected, proxied)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// Where debug traces are written.
+// Var to be overriden in tests
+var debugOutput io.Writer = os.Stderr
+
+// Print a debug trace, if debug mode is on
+func debugf(format string, args ...interface{}) {
+	if !config.Debug {
+		return
+	}
+	fmt.Fprintf(debugOutput, "[debug] "+format+"\n", args...)
+}
+
+// tracer is an http.RoundTripper logging the calls sent through it:
+// method, URL, status and latency, and the bodies if config.DebugBodies is
+// set. Credentials are redacted.
+type tracer struct {
+	transport http.RoundTripper
+}
+
+func (t *tracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := redactURL(req.URL)
+	if config.DebugBodies {
+		debugf("> %s %s", req.Method, url)
+		for name, values := range redactHeader(req.Header) {
+			for _, v := range values {
+				debugf("> %s: %s", name, v)
+			}
+		}
+		if req.Body != nil {
+			body, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			debugf("> %s", redactBody(body))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.transport.RoundTrip(req)
+	latency := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		debugf("%s %s: %s (%s)", req.Method, url, scrub(err.Error()), latency)
+		return resp, err
+	}
+	debugf("%s %s: %s (%s)", req.Method, url, resp.Status, latency)
+
+	if config.DebugBodies {
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		debugf("< %s", redactBody(body))
+	}
+	return resp, nil
+}
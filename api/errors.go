@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is returned by API calls when the server responds with an error
+// status. Use IsNotFound, IsUnauthorized, etc. to check for a given status.
+type Error struct {
+	StatusCode int    // HTTP status code of the response
+	Message    string // Error message sent by the server, if any
+	Method     string // HTTP method of the request
+	Endpoint   string // URL of the request
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("Error: %s (status=%d)\n", message, e.StatusCode)
+}
+
+// Build an *Error from a response and its body. The message is read from
+// the JSON body ({"message": "..."}) when possible.
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.Endpoint = resp.Request.URL.String()
+	}
+	var em struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &em); err == nil {
+		e.Message = em.Message
+	}
+	return e
+}
+
+// Return the status code of err if it is an API error, 0 otherwise
+func StatusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// Whether err is an API error with status 401 (missing or invalid token)
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// Whether err is an API error with status 403
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+// Whether err is an API error with status 404 (project or resource missing)
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// Whether err is an API error with status 429
+func IsRateLimited(err error) bool {
+	return StatusCode(err) == http.StatusTooManyRequests
+}
+
+// Whether err is an API error with a 5xx status
+func IsServerError(err error) bool {
+	return StatusCode(err) >= 500
+}
+
+// A feature of the toolbelt that isn't available on all the API versions
+type Feature string
+
+const (
+	FeatureAutoUpdate Feature = "Auto update"
+	FeatureLiveEval   Feature = "Live dependencies evaluation"
+	FeatureMonitoring Feature = "Setting monitored"
+	FeatureTeams      Feature = "Team selection"
+)
+
+// UnsupportedError is returned when a feature isn't available on the API
+// version in use.
+type UnsupportedError struct {
+	Feature Feature
+	Version int
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s is not available on API version %d.", e.Feature, e.Version)
+}
+
+// Return an *UnsupportedError if feature isn't available with a, nil otherwise
+func Require(a API, feature Feature) error {
+	if a.Supports(feature) {
+		return nil
+	}
+	return &UnsupportedError{Feature: feature, Version: a.Version()}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestReturnsTypedErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Project not found"}`))
+		case "/projects/secret":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Invalid API Key"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`<html>Internal Server Error</html>`))
+		}
+	}))
+	defer ts.Close()
+
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{}
+
+	err := a.ProjectFetch(context.Background(), &Project{Slug: "missing"})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected an *Error, got %#v", err)
+	}
+	expected := Error{StatusCode: 404, Message: "Project not found", Method: "GET", Endpoint: ts.URL + "/projects/missing"}
+	if *e != expected {
+		t.Errorf("Expected error to be %#v, got %#v", expected, *e)
+	}
+	if !IsNotFound(err) || IsUnauthorized(err) || IsServerError(err) {
+		t.Errorf("Only IsNotFound should match %v", err)
+	}
+
+	err = a.ProjectFetch(context.Background(), &Project{Slug: "secret"})
+	if !IsUnauthorized(err) {
+		t.Errorf("IsUnauthorized should match %v", err)
+	}
+
+	// Non-JSON bodies are ignored
+	err = a.ProjectFetch(context.Background(), &Project{Slug: "blah"})
+	if !IsServerError(err) {
+		t.Errorf("IsServerError should match %v", err)
+	}
+	if err.Error() != "Error: Internal Server Error (status=500)\n" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+}
+
+func TestRequire(t *testing.T) {
+	if err := Require(NewAPIv1("https://example.com", ""), FeatureLiveEval); err != nil {
+		t.Errorf("Live evaluation should be available on v1, got %v", err)
+	}
+	a := NewAPIv2("https://example.com", "")
+	err := Require(a, FeatureLiveEval)
+	if err == nil || err.Error() != "Live dependencies evaluation is not available on API version 2." {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// The backend fails the same way if called anyway
+	if _, err := a.LiveEvalStart(context.Background(), nil); err == nil || err.Error() != "Live dependencies evaluation is not available on API version 2." {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := a.ProjectUpdate(context.Background(), &Project{Slug: "blah"}, map[string]interface{}{"monitored": false}); err == nil {
+		t.Error("Setting monitored should fail on v2")
+	}
+}
@@ -1,6 +1,13 @@
 package api
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
+
+// The models below are shared by all the API versions. APIv1 decodes its
+// responses into them directly, APIv2 converts its own models (see v2models.go).
+// The fields only known with API v2 are not part of the JSON encoding.
 
 type Advisory struct {
 	ID               int      `json:"id"`
@@ -13,6 +20,17 @@ type Advisory struct {
 	CuredVersions    string   `json:"cured_versions"`
 	Credits          string   `json:"credits"`
 	Links            []string `json:"links"`
+	// Publication date, only known with API v2
+	Date time.Time `json:"-"`
+}
+
+// Return the reference of the advisory to display: its ID with API v1, or
+// its identifier with API v2 (ex: CVE-2014-1234).
+func (a Advisory) Ref() string {
+	if a.ID != 0 {
+		return strconv.Itoa(a.ID)
+	}
+	return a.Identifier
 }
 
 type Alert struct {
@@ -21,6 +39,15 @@ type Alert struct {
 	Status   string    `json:"status"`
 }
 
+// Return the date of the alert: when it was open with API v1, or when the
+// advisory was published with API v2.
+func (a Alert) Date() time.Time {
+	if a.OpenAt.IsZero() {
+		return a.Advisory.Date
+	}
+	return a.OpenAt
+}
+
 type Dependency struct {
 	Requirement   string     `json:"requirement"`
 	LockedVersion string     `json:"locked"`
@@ -52,15 +79,36 @@ type Package struct {
 }
 
 type Project struct {
-	Name              string `json:"name,omitempty"`
-	Slug              string `json:"slug,omitempty"`
-	Description       string `json:"description,omitempty"`
-	Origin            string `json:"origin,omitempty"`
-	Private           bool   `json:"private,omitempty"`
-	Color             string `json:"color,omitempty"`
-	Monitored         bool   `json:"monitored,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Slug        string `json:"slug,omitempty"`
+	Description string `json:"description,omitempty"`
+	Origin      string `json:"origin,omitempty"`
+	Private     bool   `json:"private,omitempty"`
+	Color       string `json:"color,omitempty"`
+	// nil when the API doesn't report it (v2 has no unmonitored projects)
+	Monitored         *bool  `json:"monitored,omitempty"`
 	UnmonitoredReason string `json:"unmonitored_reason,omitempty"`
 	CommitSHA         string `json:"commit_sha"`
+	// Branch of the latest commit, only known with API v2
+	Branch string `json:"-"`
+	// Team owning the project, only known with API v2
+	Team *Team `json:"-"`
+}
+
+// Result of a push of dependency files. API v1 reports the status of each
+// file, API v2 the commit created with the files.
+type PushResult struct {
+	Added       []DependencyFile `json:"added,omitempty"`
+	Updated     []DependencyFile `json:"updated,omitempty"`
+	Unchanged   []DependencyFile `json:"unchanged,omitempty"`
+	Unsupported []DependencyFile `json:"unsupported,omitempty"`
+	Branch      string           `json:"branch,omitempty"`
+	CommitSHA   string           `json:"commit_sha,omitempty"`
+}
+
+// Return true if the API reported the status of each file
+func (r *PushResult) HasFileStatuses() bool {
+	return r.Added != nil || r.Updated != nil || r.Unchanged != nil || r.Unsupported != nil
 }
 
 type RequirementUpdate struct {
@@ -68,6 +116,11 @@ type RequirementUpdate struct {
 	Patch string                `json:"patch"`
 }
 
+type Team struct {
+	Slug  string `json:"slug"`
+	Owner User   `json:"owner"`
+}
+
 type UpdateSet struct {
 	ID                 int                            `json:"id"`
 	RequirementUpdates map[string][]RequirementUpdate `json:"requirement_updates"`
@@ -81,6 +134,11 @@ type UpdateSetResult struct {
 	DependencyFiles []DependencyFile `json:"dependency_files"`
 }
 
+type User struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
 type VersionUpdate struct {
 	Package       Package
 	OldVersion    string `json:"old_version"`
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An HTTP request/response pair, as saved in a recording directory
+type interaction struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header"`
+		Body   string      `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"status_code"`
+		Header     http.Header `json:"header"`
+		Body       string      `json:"body,omitempty"`
+	} `json:"response"`
+}
+
+// recorder is an http.RoundTripper saving each request/response pair sent
+// through it in dir, one JSON file per pair. Credentials are redacted.
+// Files are numbered, so that a recording can be replayed in order.
+type recorder struct {
+	dir       string
+	transport http.RoundTripper
+	counter   *recordCounter
+}
+
+// Numbering of the files of a recording directory. It's shared by all the
+// recorders writing to the same dir (like the client probing the API version
+// and the main client), so that they don't reuse each other's numbers.
+type recordCounter struct {
+	mu    sync.Mutex
+	count int
+}
+
+var (
+	recordCountersMu sync.Mutex
+	recordCounters   = map[string]*recordCounter{}
+)
+
+func newRecorder(dir string, transport http.RoundTripper) *recorder {
+	key := dir
+	if abs, err := filepath.Abs(dir); err == nil {
+		key = abs
+	}
+	recordCountersMu.Lock()
+	defer recordCountersMu.Unlock()
+	counter, ok := recordCounters[key]
+	if !ok {
+		// Keep on numbering after the existing files, to record several runs
+		counter = &recordCounter{count: lastRecordNumber(dir)}
+		recordCounters[key] = counter
+	}
+	return &recorder{dir: dir, transport: transport, counter: counter}
+}
+
+// Highest number of the files already recorded in dir
+func lastRecordNumber(dir string) int {
+	last := 0
+	existing, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, path := range existing {
+		var n int
+		if _, err := fmt.Sscanf(filepath.Base(path), "%d-", &n); err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var i interaction
+	i.Request.Method = req.Method
+	i.Request.URL = redactURL(req.URL)
+	i.Request.Header = redactHeader(req.Header)
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		i.Request.Body = string(redactBody(body))
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	i.Response.StatusCode = resp.StatusCode
+	i.Response.Header = redactHeader(resp.Header)
+	i.Response.Body = string(redactBody(body))
+
+	if err := r.save(&i); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_.]+`)
+
+func (r *recorder) save(i *interaction) error {
+	r.counter.mu.Lock()
+	defer r.counter.mu.Unlock()
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	r.counter.count++
+	u, err := url.Parse(i.Request.URL)
+	if err != nil {
+		return err
+	}
+	name := strings.Trim(unsafeChars.ReplaceAllString(i.Request.Method+" "+u.Path, "-"), "-")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(r.dir, fmt.Sprintf("%04d-%s.json", r.counter.count, name))
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// replayer is an http.RoundTripper answering requests with the responses
+// saved by a recorder, without any network access. Each request gets the
+// first response not replayed yet with the same method and URL path and
+// query, so that a sequence of calls to the same URL (like polling a live
+// evaluation) is replayed in order.
+type replayer struct {
+	dir          string
+	mu           sync.Mutex
+	interactions []*interaction
+	loaded       bool
+}
+
+func newReplayer(dir string) *replayer {
+	return &replayer{dir: dir}
+}
+
+// Load the recording. Errors are returned on the first request, as API
+// constructors don't return errors.
+func (r *replayer) load() error {
+	if r.loaded {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("replay: no recording found in %s", r.dir)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		i := &interaction{}
+		if err := json.Unmarshal(data, i); err != nil {
+			return fmt.Errorf("replay: %s: %s", path, err)
+		}
+		r.interactions = append(r.interactions, i)
+	}
+	r.loaded = true
+	return nil
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	for n, i := range r.interactions {
+		u, err := url.Parse(i.Request.URL)
+		if err != nil {
+			return nil, err
+		}
+		if i.Request.Method != req.Method || u.RequestURI() != req.URL.RequestURI() {
+			continue
+		}
+		r.interactions = append(r.interactions[:n], r.interactions[n+1:]...)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+			StatusCode:    i.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        i.Response.Header,
+			Body:          ioutil.NopCloser(strings.NewReader(i.Response.Body)),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("replay: no recorded response left for %s %s", req.Method, req.URL.RequestURI())
+}
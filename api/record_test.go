@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium-recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var polls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/blah":
+			w.Header().Set("Set-Cookie", "session=secret-session")
+			w.Write([]byte(`{"slug": "blah", "name": "Blah"}`))
+		case "/evaluate/1":
+			polls++
+			if polls == 1 {
+				w.Write([]byte(`{"status": "working"}`))
+				return
+			}
+			w.Write([]byte(`{"status": "done", "result": {"runtime_status": "green"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not found"}`))
+		}
+	}))
+
+	orgRecordDir, orgReplayDir := config.RecordDir, config.ReplayDir
+	defer func() { config.RecordDir, config.ReplayDir = orgRecordDir, orgReplayDir }()
+
+	// Record
+	config.RecordDir = dir
+	a := NewAPIv1(ts.URL, "secret-api-key")
+	a.retry = RetryPolicy{}
+	p := &Project{Slug: "blah"}
+	if err := a.ProjectFetch(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{"working", "done"} {
+		resp, _, err := a.LiveEvalGetResponse(context.Background(), "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != status {
+			t.Errorf("Expected status %s, got %s", status, resp.Status)
+		}
+	}
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "unknown"}); !IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	ts.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 4 {
+		t.Fatalf("Expected 4 recorded calls, got %d", len(files))
+	}
+	if filepath.Base(files[0]) != "0001-GET-projects-blah.json" {
+		t.Errorf("Unexpected file name: %s", filepath.Base(files[0]))
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"secret-api-key", "secret-session"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s: %s should have been redacted:\n%s", f, secret, data)
+			}
+		}
+	}
+
+	// Replay, the server is closed
+	config.RecordDir = ""
+	config.ReplayDir = dir
+	a = NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{}
+	p = &Project{Slug: "blah"}
+	if err := a.ProjectFetch(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Blah" {
+		t.Errorf("Expected project name to be 'Blah', got '%s'", p.Name)
+	}
+	for _, status := range []string{"working", "done"} {
+		resp, _, err := a.LiveEvalGetResponse(context.Background(), "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != status {
+			t.Errorf("Expected replayed status %s, got %s", status, resp.Status)
+		}
+	}
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "unknown"}); !IsNotFound(err) {
+		t.Errorf("Expected a replayed not found error, got %v", err)
+	}
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err == nil {
+		t.Error("Calls should not be replayed twice")
+	}
+}
+
+func TestRecordersShareNumbering(t *testing.T) {
+	dir := t.TempDir()
+	// A file left by a previous run, with a gap in the numbering
+	if err := ioutil.WriteFile(filepath.Join(dir, "0007-GET-previous.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	// Like the client probing the API version and the main client
+	probe := newRecorder(dir, http.DefaultTransport)
+	client := newRecorder(dir, http.DefaultTransport)
+	for _, r := range []*recorder{probe, client, probe} {
+		req, err := http.NewRequest("GET", ts.URL+"/version", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := r.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	expected := "0007-GET-previous.json 0008-GET-version.json 0009-GET-version.json 0010-GET-version.json"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("Expected files %s, got %s", expected, strings.Join(names, " "))
+	}
+}
+
+func TestRedact(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Basic eDpzZWNyZXQ=")
+	h.Set("Content-Type", "application/json")
+	redacted := redactHeader(h)
+	if got := redacted.Get("Authorization"); got != "Basic REDACTED" {
+		t.Errorf("Expected Authorization to be redacted, got %s", got)
+	}
+	if h.Get("Authorization") != "Basic eDpzZWNyZXQ=" {
+		t.Error("Original header should not be modified")
+	}
+	if got := redacted.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type should be kept, got %s", got)
+	}
+
+	body := `{"email": "bruce@example.com", "password": "bat\"man", "api_key":"secret", "name": "Bruce"}`
+	expected := `{"email": "bruce@example.com", "password": "REDACTED", "api_key":"REDACTED", "name": "Bruce"}`
+	if got := string(redactBody([]byte(body))); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Placeholder for secrets removed from recordings and logs
+const Redacted = "REDACTED"
+
+// Secrets known at runtime (API keys, JWT, netrc passwords), scrubbed
+// wherever they appear
+var (
+	secretsMu sync.Mutex
+	secrets   []string
+)
+
+// Register a secret to be scrubbed from the debug logs and the recordings.
+// Secrets too short to be told from regular text are ignored.
+func AddSecret(secret string) {
+	if len(secret) < 6 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+// Replace the registered secrets found in s
+func scrub(s string) string {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, Redacted, -1)
+	}
+	return s
+}
+
+// Headers carrying credentials
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// JSON fields carrying credentials, in request or response bodies
+var secretFields = regexp.MustCompile(`("(?:api_key|api_token|password|jwt)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// Return a copy of h with the credentials redacted. The auth scheme of the
+// Authorization header is kept, so that a reader can tell basic auth (API
+// key) from a bearer token (JWT).
+func redactHeader(h http.Header) http.Header {
+	redacted := http.Header{}
+	for k, v := range h {
+		redacted[k] = append([]string(nil), v...)
+	}
+	for _, name := range secretHeaders {
+		values := redacted[http.CanonicalHeaderKey(name)]
+		for i, v := range values {
+			if scheme := strings.SplitN(v, " ", 2); name == "Authorization" && len(scheme) == 2 {
+				values[i] = scheme[0] + " " + Redacted
+			} else {
+				values[i] = Redacted
+			}
+		}
+	}
+	for _, values := range redacted {
+		for i, v := range values {
+			values[i] = scrub(v)
+		}
+	}
+	return redacted
+}
+
+// Return u as a string, with the password of the user info and the
+// registered secrets redacted
+func redactURL(u *url.URL) string {
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			redacted := *u
+			redacted.User = url.UserPassword(u.User.Username(), Redacted)
+			u = &redacted
+		}
+	}
+	return scrub(u.String())
+}
+
+// Return body with the values of the credential fields and the registered
+// secrets redacted
+func redactBody(body []byte) []byte {
+	body = secretFields.ReplaceAll(body, []byte(`$1"`+Redacted+`"`))
+	return []byte(scrub(string(body)))
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// RetryPolicy describes how idempotent API calls are retried when the server
+// or the network fails transiently (429, 502, 503, 504, connection reset).
+type RetryPolicy struct {
+	MaxRetries int           // Number of retries after the first attempt
+	MinWait    time.Duration // Wait before the first retry, doubled on each retry
+	MaxWait    time.Duration // Upper bound for a single wait, Retry-After included
+}
+
+// Wait for d, or until ctx is done.
+// Lambda to be overriden in tests
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Return the retry policy set in the config file or env vars
+func NewRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: config.MaxRetries,
+		MinWait:    config.RetryWait,
+		MaxWait:    config.RetryMaxWait,
+	}
+}
+
+// Send the request returned by newRequest with client. Idempotent requests
+// are sent again on transient failures, as long as retries are left and ctx
+// is not done. newRequest is called for each attempt, so that the body can be
+// read again.
+func (p RetryPolicy) Do(ctx context.Context, client *http.Client, idempotent bool, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if !idempotent || attempt >= p.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+		if err != nil {
+			if !isTransientError(err) {
+				return nil, err
+			}
+			if err := sleep(ctx, p.wait(attempt, nil)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !isTransientStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		// Drain the body to let the connection be reused
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if err := sleep(ctx, p.wait(attempt, resp)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Return how long to wait before the next attempt. The Retry-After header
+// of the response is honored if present, otherwise an exponential backoff
+// with jitter is used.
+func (p RetryPolicy) wait(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return p.cap(d)
+		}
+	}
+	d := p.MinWait
+	for i := 0; i < attempt && d < p.MaxWait; i++ {
+		d *= 2
+	}
+	d = p.cap(d)
+	if d <= 0 {
+		return 0
+	}
+	// Wait between d/2 and d, so that concurrent clients don't retry together
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func (p RetryPolicy) cap(d time.Duration) time.Duration {
+	if p.MaxWait > 0 && d > p.MaxWait {
+		return p.MaxWait
+	}
+	return d
+}
+
+// Parse a Retry-After header value, either in seconds or as an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isTransientError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestRetriesTransientFailures(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"slug": "blah", "name": "Blah"}`))
+	}))
+	defer ts.Close()
+
+	var waits []time.Duration
+	orgSleep := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	defer func() { sleep = orgSleep }()
+
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{MaxRetries: 3, MinWait: time.Second, MaxWait: 10 * time.Second}
+	p := &Project{Slug: "blah"}
+	if err := a.ProjectFetch(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+	if p.Name != "Blah" {
+		t.Errorf("Expected project name to be 'Blah', got '%s'", p.Name)
+	}
+	if len(waits) != 2 || waits[0] != 2*time.Second || waits[1] != 2*time.Second {
+		t.Errorf("Expected to wait twice for 2s (Retry-After), got %v", waits)
+	}
+}
+
+func TestRequestGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"message": "Bad gateway"}`))
+	}))
+	defer ts.Close()
+
+	orgSleep := sleep
+	sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	defer func() { sleep = orgSleep }()
+
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{MaxRetries: 2, MinWait: time.Millisecond, MaxWait: time.Millisecond}
+	if err := a.ProjectFetch(context.Background(), &Project{Slug: "blah"}); err == nil {
+		t.Error("ProjectFetch should fail")
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestRequestDoesNotRetryNonIdempotentCalls(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"message": "Unavailable"}`))
+	}))
+	defer ts.Close()
+
+	orgSleep := sleep
+	sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	defer func() { sleep = orgSleep }()
+
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{MaxRetries: 3, MinWait: time.Millisecond, MaxWait: time.Millisecond}
+	if err := a.ProjectSync(context.Background(), &Project{Slug: "blah"}); err == nil {
+		t.Error("ProjectSync should fail")
+	}
+	if calls != 1 {
+		t.Errorf("POST requests should not be retried, got %d calls", calls)
+	}
+
+	// PATCH on update sets is idempotent
+	calls = 0
+	err := a.AutoUpdateStepsPush(context.Background(), "abcdef", &UpdateSetResult{UpdateSetID: 1, ProjectSlug: "blah", State: "test_passed"})
+	if err == nil {
+		t.Error("AutoUpdateStepsPush should fail")
+	}
+	if calls != 4 {
+		t.Errorf("Expected 4 calls, got %d", calls)
+	}
+}
+
+func TestRequestStopsRetryingWhenCancelled(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := NewAPIv1(ts.URL, "")
+	a.retry = RetryPolicy{MaxRetries: 3, MinWait: time.Hour, MaxWait: time.Hour}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := a.ProjectFetch(ctx, &Project{Slug: "blah"})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	p := RetryPolicy{MaxRetries: 5, MinWait: time.Second, MaxWait: 5 * time.Second}
+	var tt = []struct {
+		Attempt  int
+		Min, Max time.Duration
+	}{
+		{0, 500 * time.Millisecond, time.Second},
+		{1, time.Second, 2 * time.Second},
+		{2, 2 * time.Second, 4 * time.Second},
+		{3, 2500 * time.Millisecond, 5 * time.Second},
+		{10, 2500 * time.Millisecond, 5 * time.Second},
+	}
+	for _, test := range tt {
+		d := p.wait(test.Attempt, nil)
+		if d < test.Min || d > test.Max {
+			t.Errorf("Attempt %d: expected wait between %s and %s, got %s", test.Attempt, test.Min, test.Max, d)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var tt = []struct {
+		Value    string
+		Expected time.Duration
+		OK       bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+	}
+	for _, test := range tt {
+		d, ok := retryAfter(test.Value)
+		if d != test.Expected || ok != test.OK {
+			t.Errorf("retryAfter(%q): expected (%s, %v), got (%s, %v)", test.Value, test.Expected, test.OK, d, ok)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"net/url"
 	"strings"
 )
@@ -10,6 +11,19 @@ type requestOptions struct {
 	URI    string
 	Body   interface{}
 	Result interface{}
+	// Idempotent requests are retried on transient failures. GET requests
+	// are always considered idempotent.
+	Idempotent bool
+	// Responses to cacheable GET requests are kept in the on-disk cache
+	Cacheable bool
+}
+
+// Decode the JSON body of a response into opts.Result, if any
+func (opts *requestOptions) decode(body []byte) error {
+	if opts.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(body, opts.Result)
 }
 
 //Returns the host name without ":" from an URL
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"bytes"
@@ -16,6 +17,9 @@ type APIv1 struct {
 	endpoint     string
 	key          string
 	host         string
+	retry        RetryPolicy
+	client       *http.Client
+	cache        *cache
 }
 
 // APIv1 constructor
@@ -28,7 +32,11 @@ func NewAPIv1(endpoint string, key string) (api *APIv1) {
 	}
 	newAPIv1.endpoint = endpoint
 	newAPIv1.key = key
+	AddSecret(key)
 	newAPIv1.host = h
+	newAPIv1.retry = NewRetryPolicy()
+	newAPIv1.client = newHTTPClient()
+	newAPIv1.cache = newCache()
 	return newAPIv1
 }
 
@@ -53,6 +61,16 @@ func (a *APIv1) Key() string {
 
 func (a *APIv1) SetKey(key string) {
 	a.key = key
+	AddSecret(key)
+}
+
+func (a *APIv1) Version() int {
+	return 1
+}
+
+func (a *APIv1) Supports(feature Feature) bool {
+	// Projects belong to users, not teams, with API v1
+	return feature != FeatureTeams
 }
 
 // Create a new API request, with needed headers for auth and content-type
@@ -69,26 +87,40 @@ func (a *APIv1) NewAPIRequest(method, urlStr string, body io.Reader) (*http.Requ
 	return req, nil
 }
 
-func (a *APIv1) request(opts *requestOptions) error {
+func (a *APIv1) request(ctx context.Context, opts *requestOptions) error {
 	url := fmt.Sprintf("%s%s", a.endpoint, opts.URI)
 
-	var reqBody io.Reader
-	if opts.Body == nil {
-		reqBody = nil
-	} else {
-		JSON, err := json.Marshal(opts.Body)
+	var JSON []byte
+	if opts.Body != nil {
+		var err error
+		JSON, err = json.Marshal(opts.Body)
 		if err != nil {
 			return err
 		}
-		reqBody = bytes.NewReader(JSON)
 	}
 
-	req, err := a.NewAPIRequest(opts.Method, url, reqBody)
-	if err != nil {
-		return err
+	var cached *cacheEntry
+	if opts.Cacheable && opts.Method == "GET" {
+		cached = a.cache.get(a.endpoint, a.key, opts.URI)
+		if cached != nil && a.cache.fresh(cached) {
+			debugf("%s %s: from cache", opts.Method, scrub(url))
+			return opts.decode(cached.Body)
+		}
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+
+	idempotent := opts.Method == "GET" || opts.Idempotent
+	resp, err := a.retry.Do(ctx, a.client, idempotent, func() (*http.Request, error) {
+		var reqBody io.Reader
+		if JSON != nil {
+			reqBody = bytes.NewReader(JSON)
+		}
+		req, err := a.NewAPIRequest(opts.Method, url, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		cached.setConditions(req)
+		return req.WithContext(ctx), nil
+	})
 	if err != nil {
 		return err
 	}
@@ -99,38 +131,43 @@ func (a *APIv1) request(opts *requestOptions) error {
 		return err
 	}
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		a.cache.touch(a.endpoint, a.key, cached)
+		return opts.decode(cached.Body)
+	}
+
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		type errMsg struct {
-			Message string `json:"message"`
-		}
-		em := &errMsg{}
-		if err := json.Unmarshal(body, &em); err != nil {
-			return fmt.Errorf("%s: %s\n", resp.Status, err)
-		}
-		return fmt.Errorf("Error: %s (status=%d)\n", em.Message, resp.StatusCode)
+		return newError(resp, body)
 	}
 
-	if opts.Result != nil {
-		if err = json.Unmarshal(body, opts.Result); err != nil {
-			return err
-		}
+	if opts.Method != "GET" {
+		// Cached responses may be outdated now
+		a.cache.clear(a.endpoint, a.key)
+	} else if opts.Cacheable {
+		a.cache.put(a.endpoint, a.key, opts.URI, resp, body)
 	}
 
-	return nil
+	return opts.decode(body)
 }
 
-func (a *APIv1) Login(email, password string) (err error) {
+func (a *APIv1) Login(ctx context.Context, email, password string) (err error) {
 	loginAsJson, err := json.Marshal(map[string]string{"email": email, "password": password})
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(a.endpoint + "/login", "application/json", bytes.NewReader(loginAsJson))
+	req, err := http.NewRequest("POST", a.endpoint+"/login", bytes.NewReader(loginAsJson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Server returned non-200 status: %v\n", resp.Status)
+		body, _ := ioutil.ReadAll(resp.Body)
+		return newError(resp, body)
 	}
 
 	// Read api token from response
@@ -144,87 +181,92 @@ func (a *APIv1) Login(email, password string) (err error) {
 
 	//Login successfull
 	a.key = response_body["api_token"]
+	AddSecret(a.key)
 	return nil
 }
 
-func (a *APIv1) AutoUpdateStepsBest(projectSlug string, revision string) (dfiles []DependencyFile, err error) {
+func (a *APIv1) AutoUpdateStepsBest(ctx context.Context, projectSlug string, revision string) (dfiles []DependencyFile, err error) {
 	opts := &requestOptions{
 		Method: "GET",
 		URI:    fmt.Sprintf("/projects/%s/revisions/%s/auto_update_steps/best", projectSlug, revision),
 		Result: &dfiles,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return dfiles, err
 }
 
-func (a *APIv1) AutoUpdateStepsNext(projectSlug string, revision string) (updateSet *UpdateSet, err error) {
+func (a *APIv1) AutoUpdateStepsNext(ctx context.Context, projectSlug string, revision string) (updateSet *UpdateSet, err error) {
 	opts := &requestOptions{
 		Method: "POST",
 		URI:    fmt.Sprintf("/projects/%s/revisions/%s/auto_update_steps/next", projectSlug, revision),
 		Result: &updateSet,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return updateSet, err
 }
 
-func (a *APIv1) AutoUpdateStepsPush(revision string, rs *UpdateSetResult) (err error) {
+func (a *APIv1) AutoUpdateStepsPush(ctx context.Context, revision string, rs *UpdateSetResult) (err error) {
 	opts := &requestOptions{
 		Method: "PATCH",
 		URI:    fmt.Sprintf("/projects/%s/revisions/%s/auto_update_steps/%d", rs.ProjectSlug, revision, rs.UpdateSetID),
 		Body:   rs,
+		// Pushing the same result twice is harmless
+		Idempotent: true,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return err
 }
 
 // Dependency alerts
 
-func (a *APIv1) DependencyAlertsGet(p *Project) (alerts []Alert, err error) {
+func (a *APIv1) DependencyAlertsGet(ctx context.Context, p *Project) (alerts []Alert, err error) {
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s/alerts", p.Slug),
-		Result: &alerts,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s/alerts", p.Slug),
+		Result:    &alerts,
+		Cacheable: true,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return alerts, err
 }
 
 // Dependency files
 
-func (a *APIv1) DependencyFilesPush(projectSlug string, dfiles []*DependencyFile) (jsonResp map[string][]DependencyFile, err error) {
+func (a *APIv1) DependencyFilesPush(ctx context.Context, projectSlug string, dfiles []*DependencyFile) (result *PushResult, err error) {
+	result = &PushResult{}
 	opts := &requestOptions{
 		Method: "POST",
 		URI:    fmt.Sprintf("/projects/%s/dependency_files", projectSlug),
 		Body:   dfiles,
-		Result: &jsonResp,
+		Result: result,
 	}
-	err = a.request(opts)
-	return jsonResp, err
+	err = a.request(ctx, opts)
+	return result, err
 }
 
 // Live eval
 
-func (a *APIv1) LiveEvalStart(requestDeps map[string][]*DependencyFile) (jsonResp map[string]interface{}, err error) {
+func (a *APIv1) LiveEvalStart(ctx context.Context, requestDeps map[string][]*DependencyFile) (jsonResp map[string]interface{}, err error) {
 	opts := &requestOptions{
 		Method: "POST",
 		URI:    "/evaluate",
 		Body:   requestDeps,
 		Result: &jsonResp,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return jsonResp, err
 }
 
-func (a *APIv1) LiveEvalGetResponse(jobId interface{}) (response LiveEvalResponse, body []byte, err error) {
+func (a *APIv1) LiveEvalGetResponse(ctx context.Context, jobId interface{}) (response LiveEvalResponse, body []byte, err error) {
 	url := fmt.Sprintf("%s%s/%s", a.endpoint, "/evaluate", jobId)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return response, body, err
 	}
+	req = req.WithContext(ctx)
 	req.SetBasicAuth("x", a.Key())
 	req.Header.Add("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return response, body, err
 	}
@@ -245,82 +287,92 @@ func (a *APIv1) LiveEvalGetResponse(jobId interface{}) (response LiveEvalRespons
 }
 
 // Project
-func (a *APIv1) ProjectList(privateOnly bool) (owner2Project map[string][]Project, err error) {
+func (a *APIv1) ProjectList(ctx context.Context, privateOnly bool) (owner2Project map[string][]Project, err error) {
 	opts := &requestOptions{
 		Method: "GET",
 		URI:    "/projects",
 		Result: &owner2Project,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return owner2Project, err
 
 }
 
-func (a *APIv1) ProjectUpdate(p *Project, update map[string]interface{}) (err error) {
+func (a *APIv1) ProjectUpdate(ctx context.Context, p *Project, update map[string]interface{}) (err error) {
 	opts := &requestOptions{
 		Method: "PATCH",
 		URI:    fmt.Sprintf("/projects/%s", p.Slug),
 		Body:   update,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return err
 }
 
-func (a *APIv1) ProjectCreate(p *Project) (jsonResp map[string]interface{}, err error) {
+func (a *APIv1) ProjectCreate(ctx context.Context, p *Project) (jsonResp map[string]interface{}, err error) {
 	opts := &requestOptions{
 		Method: "POST",
 		URI:    "/projects",
 		Body:   p,
 		Result: &jsonResp,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return jsonResp, err
 }
 
-func (a *APIv1) ProjectSync(p *Project) (err error) {
+func (a *APIv1) ProjectSync(ctx context.Context, p *Project) (err error) {
 	opts := &requestOptions{
 		Method: "POST",
 		URI:    fmt.Sprintf("/projects/%s/sync", p.Slug),
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return err
 }
 
-func (a *APIv1) ProjectFetch(p *Project) (err error) {
+func (a *APIv1) ProjectFetch(ctx context.Context, p *Project) (err error) {
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s", p.Slug),
-		Result: p,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s", p.Slug),
+		Result:    p,
+		Cacheable: true,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return err
 }
 
-func (a *APIv1) ProjectGetDependencies(p *Project) (deps []Dependency, err error) {
+func (a *APIv1) ProjectGetDependencies(ctx context.Context, p *Project) (deps []Dependency, err error) {
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s/dependencies", p.Slug),
-		Result: &deps,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s/dependencies", p.Slug),
+		Result:    &deps,
+		Cacheable: true,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return deps, err
 }
 
-func (a *APIv1) ProjectGetDependencyFiles(p *Project) (dfiles []DependencyFile, err error) {
+func (a *APIv1) ProjectGetDependencyFiles(ctx context.Context, p *Project) (dfiles []DependencyFile, err error) {
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s/dependency_files", p.Slug),
-		Result: &dfiles,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s/dependency_files", p.Slug),
+		Result:    &dfiles,
+		Cacheable: true,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return dfiles, err
 }
 
+// API v1 doesn't expose the current user: the token is checked by listing
+// the projects, and an empty user is returned if it's valid.
+func (a *APIv1) User(ctx context.Context) (user User, err error) {
+	opts := &requestOptions{
+		Method: "GET",
+		URI:    "/projects",
+	}
+	err = a.request(ctx, opts)
+	return user, err
+}
 
-
-
-
-
-
-
-
+// Teams are an API v2 feature only
+func (a *APIv1) UserTeams(ctx context.Context) (teams []Team, err error) {
+	return teams, &UnsupportedError{Feature: FeatureTeams, Version: a.Version()}
+}
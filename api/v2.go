@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"bytes"
 	"fmt"
+	"regexp"
 	"os"
 	"io"
 	"io/ioutil"
@@ -17,6 +20,9 @@ type APIv2 struct {
 	key string
 	jwt string
 	host string
+	retry RetryPolicy
+	client *http.Client
+	cache *cache
 }
 
 // APIv2 constructor
@@ -29,7 +35,11 @@ func NewAPIv2(endpoint string, key string) (api *APIv2) {
 	}
 	newAPIv2.endpoint = endpoint
 	newAPIv2.key = key
+	AddSecret(key)
 	newAPIv2.host = h
+	newAPIv2.retry = NewRetryPolicy()
+	newAPIv2.client = newHTTPClient()
+	newAPIv2.cache = newCache()
 	return newAPIv2
 }
 
@@ -54,6 +64,19 @@ func (a *APIv2) Key() string {
 
 func (a *APIv2) SetKey(key string) {
 	a.key = key
+	AddSecret(key)
+}
+
+func (a *APIv2) Version() int {
+	return 2
+}
+
+func (a *APIv2) Supports(feature Feature) bool {
+	switch feature {
+	case FeatureAutoUpdate, FeatureLiveEval, FeatureMonitoring:
+		return false
+	}
+	return true
 }
 
 // Create a new API request, with needed headers for auth and content-type
@@ -70,26 +93,40 @@ func (a *APIv2) NewAPIRequest(method, urlStr string, body io.Reader) (*http.Requ
 	return req, nil
 }
 
-func (a *APIv2) request(opts *requestOptions) error {
+func (a *APIv2) request(ctx context.Context, opts *requestOptions) error {
 	url := fmt.Sprintf("%s%s", a.endpoint, opts.URI)
 
-	var reqBody io.Reader
-	if opts.Body == nil {
-		reqBody = nil
-	} else {
-		JSON, err := json.Marshal(opts.Body)
+	var JSON []byte
+	if opts.Body != nil {
+		var err error
+		JSON, err = json.Marshal(opts.Body)
 		if err != nil {
 			return err
 		}
-		reqBody = bytes.NewReader(JSON)
 	}
 
-	req, err := a.NewAPIRequest(opts.Method, url, reqBody)
-	if err != nil {
-		return err
+	var cached *cacheEntry
+	if opts.Cacheable && opts.Method == "GET" {
+		cached = a.cache.get(a.endpoint, a.key, opts.URI)
+		if cached != nil && a.cache.fresh(cached) {
+			debugf("%s %s: from cache", opts.Method, scrub(url))
+			return opts.decode(cached.Body)
+		}
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+
+	idempotent := opts.Method == "GET" || opts.Idempotent
+	resp, err := a.retry.Do(ctx, a.client, idempotent, func() (*http.Request, error) {
+		var reqBody io.Reader
+		if JSON != nil {
+			reqBody = bytes.NewReader(JSON)
+		}
+		req, err := a.NewAPIRequest(opts.Method, url, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		cached.setConditions(req)
+		return req.WithContext(ctx), nil
+	})
 	if err != nil {
 		return err
 	}
@@ -100,38 +137,43 @@ func (a *APIv2) request(opts *requestOptions) error {
 		return err
 	}
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		a.cache.touch(a.endpoint, a.key, cached)
+		return opts.decode(cached.Body)
+	}
+
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		type errMsg struct {
-			Message string `json:"message"`
-		}
-		em := &errMsg{}
-		if err := json.Unmarshal(body, &em); err != nil {
-			return fmt.Errorf("%s: %s\n", resp.Status, err)
-		}
-		return fmt.Errorf("Error: %s (status=%d)\n", em.Message, resp.StatusCode)
+		return newError(resp, body)
 	}
 
-	if opts.Result != nil {
-		if err = json.Unmarshal(body, opts.Result); err != nil {
-			return err
-		}
+	if opts.Method != "GET" {
+		// Cached responses may be outdated now
+		a.cache.clear(a.endpoint, a.key)
+	} else if opts.Cacheable {
+		a.cache.put(a.endpoint, a.key, opts.URI, resp, body)
 	}
 
-	return nil
+	return opts.decode(body)
 }
 
-func (a *APIv2) Login(email, password string) (err error) {
+func (a *APIv2) Login(ctx context.Context, email, password string) (err error) {
 	loginAsJson, err := json.Marshal(map[string]string{"email": email, "password": password})
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(a.endpoint+"/login", "application/json", bytes.NewReader(loginAsJson))
+	req, err := http.NewRequest("POST", a.endpoint+"/login", bytes.NewReader(loginAsJson))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Server returned non-200 status: %v\n", resp.Status)
+		body, _ := ioutil.ReadAll(resp.Body)
+		return newError(resp, body)
 	}
 
 	// Read api jwt token from response
@@ -142,13 +184,14 @@ func (a *APIv2) Login(email, password string) (err error) {
 	}
 	//Login successfull
 	a.jwt = response_body["jwt"]
+	AddSecret(a.jwt)
 
 	// Now we need to fetch the user's API key, this is what we use to access the API
 	user := V2User{}
 
 	// Prepare request to the API
 	url := fmt.Sprintf("%s%s", a.endpoint, "/user")
-	req, err := http.NewRequest("GET", url, nil)
+	req, err = http.NewRequest("GET", url, nil)
 	if err != nil {
 		return err
 	}
@@ -162,8 +205,7 @@ func (a *APIv2) Login(email, password string) (err error) {
 		return err
 	}
 	// Access API
-	client := &http.Client{}
-	resp, err = client.Do(req)
+	resp, err = a.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -176,14 +218,7 @@ func (a *APIv2) Login(email, password string) (err error) {
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		// Request failed
-		type errMsg struct {
-			Message string `json:"message"`
-		}
-		em := &errMsg{}
-		if err := json.Unmarshal(body, &em); err != nil {
-			return fmt.Errorf("%s: %s\n", resp.Status, err)
-		}
-		return fmt.Errorf("Error: %s (status=%d)\n", em.Message, resp.StatusCode)
+		return newError(resp, body)
 	}
 
 	// Get user struct from response
@@ -192,197 +227,237 @@ func (a *APIv2) Login(email, password string) (err error) {
 	}
 	// Get API Key field
 	a.key = user.APIKey
+	AddSecret(a.key)
 
 	return nil
 }
 
-func (a *APIv2) AutoUpdateStepsBest(projectSlug string, revision string) (dfiles []DependencyFile, err error) {
-	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s/revisions/%s/auto_update_steps/best", projectSlug, revision),
-		Result: &dfiles,
-	}
-	err = a.request(opts)
-	return dfiles, err
+// Auto update and live evaluation are API v1 features only
+
+func (a *APIv2) AutoUpdateStepsBest(ctx context.Context, projectSlug string, revision string) (dfiles []DependencyFile, err error) {
+	return dfiles, a.unsupported(FeatureAutoUpdate)
 }
 
-func (a *APIv2) AutoUpdateStepsNext(projectSlug string, revision string) (updateSet *UpdateSet, err error) {
-	opts := &requestOptions{
-		Method: "POST",
-		URI:    fmt.Sprintf("/projects/%s/revisions/%s/auto_update_steps/next", projectSlug, revision),
-		Result: &updateSet,
-	}
-	err = a.request(opts)
-	return updateSet, err
+func (a *APIv2) AutoUpdateStepsNext(ctx context.Context, projectSlug string, revision string) (updateSet *UpdateSet, err error) {
+	return updateSet, a.unsupported(FeatureAutoUpdate)
 }
 
-func (a *APIv2) AutoUpdateStepsPush(revision string, rs *UpdateSetResult) (err error) {
-	opts := &requestOptions{
-		Method: "PATCH",
-		URI:    fmt.Sprintf("/projects/%s/revisions/%s/auto_update_steps/%d", rs.ProjectSlug, revision, rs.UpdateSetID),
-		Body:   rs,
-	}
-	err = a.request(opts)
-	return err
+func (a *APIv2) AutoUpdateStepsPush(ctx context.Context, revision string, rs *UpdateSetResult) (err error) {
+	return a.unsupported(FeatureAutoUpdate)
 }
 
 // Dependency alerts
 
-func (a *APIv2) DependencyAlertsGet(p *V2Project) (alerts []V2Alert, err error) {
+func (a *APIv2) DependencyAlertsGet(ctx context.Context, p *Project) (alerts []Alert, err error) {
+	var v2alerts []V2Alert
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s/alerts", p.Slug),
-		Result: &alerts,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s/alerts", p.Slug),
+		Result:    &v2alerts,
+		Cacheable: true,
+	}
+	if err = a.request(ctx, opts); err != nil {
+		return alerts, err
 	}
-	err = a.request(opts)
-	return alerts, err
+	for _, v2alert := range v2alerts {
+		alerts = append(alerts, v2alert.alert())
+	}
+	return alerts, nil
 }
 
 // Dependency files
 
-func (a *APIv2) DependencyFilesPush(projectSlug string, dfiles []*V2DependencyFile) (jsonResp *V2Commit, err error) {
+// The content of the files is base64 encoded, like with the []byte content
+// of DependencyFile, so they are sent as is.
+func (a *APIv2) DependencyFilesPush(ctx context.Context, projectSlug string, dfiles []*DependencyFile) (result *PushResult, err error) {
+	var commit V2Commit
 	opts := &requestOptions{
 		Method: "POST",
 		URI:    fmt.Sprintf("/projects/%s/dependency_files", projectSlug),
 		Body:   dfiles,
-		Result: &jsonResp,
+		Result: &commit,
 	}
-	err = a.request(opts)
-	return jsonResp, err
+	if err = a.request(ctx, opts); err != nil {
+		return nil, err
+	}
+	return &PushResult{Branch: commit.Branch, CommitSHA: commit.CommitSHA}, nil
 }
 
 // Live eval
 
-func (a *APIv2) LiveEvalStart(requestDeps map[string][]*DependencyFile) (jsonResp map[string]interface{}, err error) {
-	opts := &requestOptions{
-		Method: "POST",
-		URI:    "/evaluate",
-		Body:   requestDeps,
-		Result: &jsonResp,
-	}
-	err = a.request(opts)
-	return jsonResp, err
+func (a *APIv2) LiveEvalStart(ctx context.Context, requestDeps map[string][]*DependencyFile) (jsonResp map[string]interface{}, err error) {
+	return jsonResp, a.unsupported(FeatureLiveEval)
 }
 
-func (a *APIv2) LiveEvalGetResponse(jobId interface{}) (response LiveEvalResponse, body []byte, err error) {
-	url := fmt.Sprintf("%s%s/%s", a.endpoint, "/evaluate", jobId)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return response, body, err
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", a.jwt))
-	req.Header.Add("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return response, body, err
-	}
-	defer resp.Body.Close()
-	body, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return response, body, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		response.Status = "error"
-	}
-
-	if err = json.Unmarshal(body, &response); err != nil {
-		return response, body, err
-	}
-	return response, body, err
+func (a *APIv2) LiveEvalGetResponse(ctx context.Context, jobId interface{}) (response LiveEvalResponse, body []byte, err error) {
+	return response, body, a.unsupported(FeatureLiveEval)
 }
 
 // Project
 
-
-func (a *APIv2) ProjectList(privateOnly bool) (projects []V2Project, err error) {
+// Projects are grouped by owner of their team, like with API v1: the ones of
+// the current user's teams are "owned".
+func (a *APIv2) ProjectList(ctx context.Context, privateOnly bool) (owner2Project map[string][]Project, err error) {
+	var projects []V2Project
 	opts := &requestOptions{
 		Method: "GET",
 		URI:    "/user/projects",
 		Result: &projects,
 	}
-	err = a.request(opts)
-	return projects, err
-
+	if err = a.request(ctx, opts); err != nil {
+		return owner2Project, err
+	}
+	currentUser, err := a.User(ctx)
+	if err != nil {
+		return owner2Project, err
+	}
+	owner2Project = map[string][]Project{}
+	for _, v2p := range projects {
+		owner := v2p.Team.Owner.Name
+		if v2p.Team.Owner.Email == currentUser.Email {
+			owner = "owned"
+		}
+		owner2Project[owner] = append(owner2Project[owner], v2p.project())
+	}
+	return owner2Project, nil
 }
 
-func (a *APIv2) ProjectUpdate(p *V2Project, update map[string]interface{}) (err error) {
+func (a *APIv2) ProjectUpdate(ctx context.Context, p *Project, update map[string]interface{}) (err error) {
+	body := map[string]interface{}{}
+	for k, v := range update {
+		switch k {
+		case "monitored":
+			return a.unsupported(FeatureMonitoring)
+		case "desc":
+			body["description"] = v
+		default:
+			body[k] = v
+		}
+	}
 	opts := &requestOptions{
 		Method: "PATCH",
 		URI:    fmt.Sprintf("/projects/%s", p.Slug),
-		Body:   update,
+		Body:   body,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return err
 }
 
-func (a *APIv2) ProjectCreate(team string, p *V2Project) (jsonResp map[string]interface{}, err error) {
+// The project is created in p.Team, or in the first team of the current user
+// if not set.
+func (a *APIv2) ProjectCreate(ctx context.Context, p *Project) (jsonResp map[string]interface{}, err error) {
+	team := p.Team
+	if team == nil {
+		teams, err := a.UserTeams(ctx)
+		if err != nil {
+			return jsonResp, err
+		}
+		if len(teams) == 0 {
+			return jsonResp, errors.New("Current user has no team !")
+		}
+		team = &teams[0]
+	}
+	v2p := &V2Project{
+		Basename:    makeBasename(p.Name),
+		Name:        p.Name,
+		Description: p.Description,
+		Private:     p.Private,
+	}
 	opts := &requestOptions{
 		Method: "POST",
-		URI:    fmt.Sprintf("/teams/%s/projects", team),
-		Body:   p,
+		URI:    fmt.Sprintf("/teams/%s/projects", team.Slug),
+		Body:   v2p,
 		Result: &jsonResp,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return jsonResp, err
 }
 
-func (a *APIv2) ProjectSync(p *V2Project) (err error) {
+func (a *APIv2) ProjectSync(ctx context.Context, p *Project) (err error) {
 	opts := &requestOptions{
 		Method: "POST",
 		URI:    fmt.Sprintf("/projects/%s/sync", p.Slug),
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return err
 }
 
-func (a *APIv2) ProjectFetch(p *V2Project) (err error) {
+func (a *APIv2) ProjectFetch(ctx context.Context, p *Project) (err error) {
+	var v2p V2Project
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s", p.Slug),
-		Result: p,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s", p.Slug),
+		Result:    &v2p,
+		Cacheable: true,
 	}
-	err = a.request(opts)
-	return err
+	if err = a.request(ctx, opts); err != nil {
+		return err
+	}
+	*p = v2p.project()
+	return nil
 }
 
-func (a *APIv2) ProjectGetDependencies(p *Project) (deps []Dependency, err error) {
+func (a *APIv2) ProjectGetDependencies(ctx context.Context, p *Project) (deps []Dependency, err error) {
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s/dependencies", p.Slug),
-		Result: &deps,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s/dependencies", p.Slug),
+		Result:    &deps,
+		Cacheable: true,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return deps, err
 }
 
-func (a *APIv2) ProjectGetDependencyFiles(p *V2Project) (dfiles []V2DependencyFile, err error) {
+// The content of the files is base64 encoded, and decoded into the []byte
+// content of DependencyFile.
+func (a *APIv2) ProjectGetDependencyFiles(ctx context.Context, p *Project) (dfiles []DependencyFile, err error) {
 	opts := &requestOptions{
-		Method: "GET",
-		URI:    fmt.Sprintf("/projects/%s/dependency_files", p.Slug),
-		Result: &dfiles,
+		Method:    "GET",
+		URI:       fmt.Sprintf("/projects/%s/dependency_files", p.Slug),
+		Result:    &dfiles,
+		Cacheable: true,
 	}
-	err = a.request(opts)
+	err = a.request(ctx, opts)
 	return dfiles, err
 }
 
-func (a *APIv2) User() (user V2User, err error) {
+// User
+
+func (a *APIv2) User(ctx context.Context) (user User, err error) {
+	var v2user V2User
 	opts := &requestOptions{
 		Method: "GET",
-		URI: "/user",
-		Result: &user,
+		URI:    "/user",
+		Result: &v2user,
 	}
-	err = a.request(opts)
-	return user, err
+	err = a.request(ctx, opts)
+	return v2user.user(), err
 }
 
-func (a *APIv2) UserTeams() (teams []V2Team, err error) {
+func (a *APIv2) UserTeams(ctx context.Context) (teams []Team, err error) {
+	var v2teams []V2Team
 	opts := &requestOptions{
 		Method: "GET",
-		URI: "/user/teams",
-		Result: &teams,
+		URI:    "/user/teams",
+		Result: &v2teams,
+	}
+	if err = a.request(ctx, opts); err != nil {
+		return teams, err
+	}
+	for _, v2team := range v2teams {
+		teams = append(teams, v2team.team())
 	}
-	err = a.request(opts)
-	return teams, err
+	return teams, nil
 }
+
+func (a *APIv2) unsupported(feature Feature) error {
+	return &UnsupportedError{Feature: feature, Version: a.Version()}
+}
+
+// Return a basename for a project named name, made of its letters, digits,
+// dashes and underscores
+func makeBasename(name string) string {
+	return basenameRegexp.ReplaceAllString(name, "")
+}
+
+var basenameRegexp = regexp.MustCompile("[^a-zA-Z0-9_-]+")
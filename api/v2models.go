@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 )
 
+// The models below are the ones of API v2. They are converted into the
+// models shared by all the API versions (see models.go) by APIv2.
+
 // We need to create marshal / unmarshal funtion for the Date field
 type V2AdvisoryDate time.Time
 
@@ -20,7 +23,7 @@ func (j *V2AdvisoryDate) UnmarshalJSON(b []byte) error {
 }
 
 func (j V2AdvisoryDate) MarshalJSON() ([]byte, error) {
-	return json.Marshal(j)
+	return json.Marshal(j.Format("2006-01-02"))
 }
 
 func (j V2AdvisoryDate) Format(s string) string {
@@ -29,8 +32,16 @@ func (j V2AdvisoryDate) Format(s string) string {
 }
 
 type V2Advisory struct {
-	Identifier       string   `json:"identifier"`
-	Date     V2AdvisoryDate `json:"date"`
+	Identifier    string         `json:"identifier"`
+	Date          V2AdvisoryDate `json:"date"`
+	Title         string         `json:"title,omitempty"`
+	Description   string         `json:"description,omitempty"`
+	Solution      string         `json:"solution,omitempty"`
+	AffectedRange string         `json:"affected_range,omitempty"`
+	FixedVersions []string       `json:"fixed_versions,omitempty"`
+	Credit        string         `json:"credit,omitempty"`
+	URLs          []string       `json:"urls,omitempty"`
+	PackageSlug   string         `json:"package_slug,omitempty"`
 }
 
 type V2Alert struct {
@@ -75,3 +86,48 @@ type V2User struct {
 	Provider          string `json:"provider,omitempty"`
 	TimeZone          string `json:"time_zone,omitempty"`
 }
+
+func (a V2Advisory) advisory() Advisory {
+	return Advisory{
+		Identifier:       a.Identifier,
+		Date:             time.Time(a.Date),
+		Title:            a.Title,
+		Description:      a.Description,
+		Solution:         a.Solution,
+		AffectedVersions: a.AffectedRange,
+		CuredVersions:    strings.Join(a.FixedVersions, ", "),
+		Credits:          a.Credit,
+		Links:            a.URLs,
+		Package:          Package{Slug: a.PackageSlug},
+	}
+}
+
+func (a V2Alert) alert() Alert {
+	return Alert{Advisory: a.Advisory.advisory(), Status: a.Status}
+}
+
+func (p V2Project) project() Project {
+	project := Project{
+		Name:        p.Name,
+		Slug:        p.Slug,
+		Description: p.Description,
+		Origin:      p.Origin,
+		Private:     p.Private,
+		Color:       p.Color,
+		CommitSHA:   p.LatestCommit.CommitSHA,
+		Branch:      p.LatestCommit.Branch,
+	}
+	if p.Team.Slug != "" {
+		team := p.Team.team()
+		project.Team = &team
+	}
+	return project
+}
+
+func (t V2Team) team() Team {
+	return Team{Slug: t.Slug, Owner: t.Owner.user()}
+}
+
+func (u V2User) user() User {
+	return User{Name: u.Name, Email: u.Email}
+}
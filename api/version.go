@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// How long a detected API version is kept in cache
+const versionCacheTTL = 24 * time.Hour
+
+type detectedVersion struct {
+	Version    int       `json:"version"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// Return the version (1 or 2) of the API served at endpoint.
+// The endpoint is probed with a GET on /user, a route only served by v2, and
+// the result is cached per endpoint (host and path). If the probe is
+// inconclusive (network error, authentication required), the version is
+// guessed from the endpoint URL instead, and not cached.
+func DetectVersion(ctx context.Context, endpoint, key string) int {
+	versions := loadDetectedVersions()
+	if d, ok := versions[endpoint]; ok && now().Sub(d.DetectedAt) < versionCacheTTL {
+		return d.Version
+	}
+	version, ok := probeVersion(ctx, endpoint, key)
+	if !ok {
+		return guessVersion(endpoint)
+	}
+	versions[endpoint] = detectedVersion{Version: version, DetectedAt: now()}
+	saveDetectedVersions(versions)
+	return version
+}
+
+func probeVersion(ctx context.Context, endpoint, key string) (version int, ok bool) {
+	req, err := http.NewRequest("GET", endpoint+"/user", nil)
+	if err != nil {
+		return 0, false
+	}
+	if key != "" {
+		req.SetBasicAuth("x", key)
+	}
+	req.Header.Add("X-Gms-Client-Version", config.VERSION)
+	resp, err := newHTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, false
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return 1, true
+	case http.StatusOK:
+		// A v2 user, not a mirror answering 200 to everything
+		var user map[string]interface{}
+		if json.Unmarshal(body, &user) == nil && user["email"] != nil {
+			return 2, true
+		}
+	}
+	return 0, false
+}
+
+// Guess the API version from the endpoint URL: v1 for the default endpoint
+// and URLs ending with /v1, v2 otherwise (ex: https://gemnasium.my.domain/api/v2).
+func guessVersion(endpoint string) int {
+	if endpoint == config.DEFAULT_API_ENDPOINT {
+		return 1
+	}
+	if u, err := url.Parse(endpoint); err == nil && strings.HasSuffix(strings.TrimRight(u.Path, "/"), "/v1") {
+		return 1
+	}
+	return 2
+}
+
+func detectedVersionsPath() string {
+	dir := cacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "api_versions.json")
+}
+
+func loadDetectedVersions() map[string]detectedVersion {
+	versions := map[string]detectedVersion{}
+	path := detectedVersionsPath()
+	if path == "" {
+		return versions
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &versions)
+	}
+	return versions
+}
+
+func saveDetectedVersions(versions map[string]detectedVersion) {
+	path := detectedVersionsPath()
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return
+	}
+	writeFileAtomic(path, data)
+}
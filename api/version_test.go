@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+func TestDetectVersion(t *testing.T) {
+	var tt = []struct {
+		Name     string
+		Status   int
+		Body     string
+		Path     string
+		Expected int
+	}{
+		{"v1", http.StatusNotFound, `{"message": "Not found"}`, "", 1},
+		{"v2", http.StatusOK, `{"name": "Bruce", "email": "bruce@example.com"}`, "", 2},
+		{"inconclusive, guessed v1", http.StatusUnauthorized, `{"message": "Unauthorized"}`, "/v1", 1},
+		{"inconclusive, guessed v2", http.StatusUnauthorized, `{"message": "Unauthorized"}`, "/api/v2", 2},
+		{"200 to everything", http.StatusOK, `<html></html>`, "/api/v1/", 1},
+	}
+	for _, test := range tt {
+		var key string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, key, _ = r.BasicAuth()
+			w.WriteHeader(test.Status)
+			w.Write([]byte(test.Body))
+		}))
+		if v := DetectVersion(context.Background(), ts.URL+test.Path, "secret-api-key"); v != test.Expected {
+			t.Errorf("%s: expected v%d, got v%d", test.Name, test.Expected, v)
+		}
+		if key != "secret-api-key" {
+			t.Errorf("%s: the probe should be authenticated", test.Name)
+		}
+		ts.Close()
+	}
+}
+
+func TestDetectVersionIsCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	orgNoCache, orgCacheDir := config.NoCache, config.CacheDir
+	config.NoCache, config.CacheDir = false, dir
+	defer func() { config.NoCache, config.CacheDir = orgNoCache, orgCacheDir }()
+
+	var probes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		if v := DetectVersion(context.Background(), ts.URL, ""); v != 1 {
+			t.Errorf("Expected v1, got v%d", v)
+		}
+	}
+	if probes != 1 {
+		t.Errorf("Expected the endpoint to be probed once, got %d probes", probes)
+	}
+}
@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/bgentry/go-netrc/netrc"
 	"github.com/bgentry/speakeasy"
@@ -23,8 +25,9 @@ const (
 )
 
 // Login with the user email and password
-// An entry will be created in ~/.netrc on successful login.
-func Login() error {
+// An entry will be created in the credential store (~/.netrc by default) on
+// successful login.
+func Login(ctx context.Context) error {
 	// Create a function to be overriden in tests
 	email := getEmail()
 	password, err := getPassword("Enter password (will be hidden): ")
@@ -32,7 +35,7 @@ func Login() error {
 		return err
 	}
 
-	err = api.APIImpl.Login(email, password)
+	err = api.APIImpl.Login(ctx, email, password)
 	if err != nil {
 		return err
 	}
@@ -47,7 +50,8 @@ func Login() error {
 }
 
 // Login with the user email and API token
-// An entry will be created in ~/.netrc on successful login.
+// An entry will be created in the credential store (~/.netrc by default) on
+// successful login.
 func LoginWithAPIToken(token string) (err error) {
 	// Create a function to be overriden in tests
 	email := getEmail()
@@ -71,9 +75,13 @@ func LoginWithAPIToken(token string) (err error) {
 }
 
 // Logout doesn't hit the API of course.
-// It simply removes the corresponding entry in ~/.netrc
+// It simply removes the corresponding entry in the credential store
 func Logout() error {
-	err := removeCreds(api.APIImpl.Host())
+	store, err := SelectedStore()
+	if err != nil {
+		return err
+	}
+	err = store.Remove(api.APIImpl.Host())
 	if err != nil {
 		return err
 	}
@@ -107,32 +115,87 @@ func readPassword(prompt string) (password string, err error) {
 	return speakeasy.Ask(prompt)
 }
 
-// Try to get credential from 3 sources (in that exact order):
-// - from netrc file
-// - local config file (ie: .gemnasium.yml), with a `api_key` yaml key
-// - from command line flag `token`
+// Resolve the API token from the first of these sources providing one:
+// - command line flag `token`
+// - env var GEMNASIUM_TOKEN
+// - file set with GEMNASIUM_TOKEN_FILE
+// - local config file (ie: .gemnasium.yml) or profile in use, with a `api_key` yaml key
+// - external command set with `credential_helper`
+// - netrc file
 //
-// Each source will override previous one (token flag has priority above all).
-//
-// WARNING: Directly exit the programm in case of error
+// The source of the token is kept in CurrentTokenSource.
 func ConfigureAPIToken(ctx *cli.Context) error {
-	// APIKey has been set localy in APIconfig file
-	if config.APIKey == "" {
-		_, config.APIKey = getCreds()
-	}
-	// User can override token
-	if ctx.GlobalString("token") != "" {
-		// Try to fetch token from command line
-		config.APIKey = ctx.GlobalString("token")
+	token, source, err := resolveToken(ctx)
+	if err != nil {
+		return err
 	}
+	CurrentTokenSource = source
 	// Configure the API instance with the chosen token
-	api.APIImpl.SetKey(config.APIKey)
-	if config.APIKey == "" {
+	api.APIImpl.SetKey(token)
+	// Recorded API keys are redacted, any key will do when replaying
+	if token == "" && config.ReplayDir == "" {
 		return ErrEmptyToken
 	}
 	return nil
 }
 
+func resolveToken(ctx *cli.Context) (string, TokenSource, error) {
+	if token := ctx.GlobalString("token"); token != "" {
+		return token, TokenFromFlag, nil
+	}
+	if token := os.Getenv(config.ENV_TOKEN); token != "" {
+		return token, TokenFromEnv, nil
+	}
+	if config.TokenFile != "" {
+		data, err := ioutil.ReadFile(config.TokenFile)
+		if err != nil {
+			return "", NoToken, fmt.Errorf("%s: %s", config.ENV_TOKEN_FILE, err)
+		}
+		// Secrets are often written with a trailing newline
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, TokenFromFile, nil
+		}
+	}
+	if config.APIKey != "" {
+		return config.APIKey, TokenFromConfigFile, nil
+	}
+	if config.CredentialHelper != "" {
+		token, err := runCredentialHelper(config.CredentialHelper, api.APIImpl.Host())
+		if err != nil {
+			return "", NoToken, fmt.Errorf("credential_helper: %s", err)
+		}
+		if token != "" {
+			return token, TokenFromCredentialHelper, nil
+		}
+	}
+	_, token, err := getCreds()
+	if err != nil {
+		return "", NoToken, err
+	}
+	if token != "" {
+		return token, TokenFromStore, nil
+	}
+	return "", NoToken, nil
+}
+
+// Run the credential helper with the API host as argument, and return the
+// first line it prints on stdout. The command is run by the shell, like git
+// credential helpers, and can prompt the user on stderr.
+// Lambda to be overriden in tests
+var runCredentialHelper = func(helper, host string) (string, error) {
+	cmd := shellCommand(helper, host)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	// Keep helper tokens out of the debug logs
+	api.AddSecret(token)
+	return token, nil
+}
+
 // Error codes returned by auth failures
 var (
 	ErrEmptyToken = errors.New("auth: You must be logged in. Please use `gemnasium auth login` first, or pass your api token with --token or GEMNASIUM_TOKEN")
@@ -159,42 +222,19 @@ var loadNetrc = func() *netrc.Netrc {
 }
 
 func saveCreds(host, user, pass string) error {
-	nrc := loadNetrc()
-	m := nrc.FindMachine(host)
-	if m == nil || m.IsDefault() {
-		m = nrc.NewMachine(host, user, pass, "")
-	}
-	m.UpdateLogin(user)
-	m.UpdatePassword(pass)
-
-	body, err := nrc.MarshalText()
+	store, err := SelectedStore()
 	if err != nil {
 		return err
 	}
-	return writeNetrcFile(body)
+	return store.Set(host, user, pass)
 }
 
 var writeNetrcFile = func(body []byte) error {
 	return ioutil.WriteFile(netrcPath(), body, 0600)
 }
 
-func removeCreds(host string) error {
-	nrc := loadNetrc()
-	nrc.RemoveMachine(host)
-
-	body, err := nrc.MarshalText()
-	if err != nil {
-		return err
-	}
-	return writeNetrcFile(body)
-}
-
-func getCreds() (user, pass string) {
-	nrc := loadNetrc()
-	if nrc == nil {
-		return "", ""
-	}
-
+// Return the credentials set in the API URL, or stored for the API host
+func getCreds() (user, pass string, err error) {
 	apiURL, err := url.Parse(api.APIImpl.Endpoint())
 	if err != nil {
 		utils.PrintFatal("invalid API URL: %s", err)
@@ -204,12 +244,13 @@ func getCreds() (user, pass string) {
 	}
 	if apiURL.User != nil {
 		pw, _ := apiURL.User.Password()
-		return apiURL.User.Username(), pw
+		api.AddSecret(pw)
+		return apiURL.User.Username(), pw, nil
 	}
 
-	m := nrc.FindMachine(apiURL.Host)
-	if m == nil {
-		return "", ""
+	store, err := SelectedStore()
+	if err != nil {
+		return "", "", err
 	}
-	return m.Login, m.Password
+	return store.Get(apiURL.Host)
 }
@@ -2,18 +2,38 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/bgentry/go-netrc/netrc"
 	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/urfave/cli"
 )
 
+func TestMain(m *testing.M) {
+	// Tests must not use the encrypted credential store of the user
+	dir, err := ioutil.TempDir("", "gemnasium-auth")
+	if err != nil {
+		panic(err)
+	}
+	encryptedStorePath = func() string {
+		return filepath.Join(dir, "credentials.enc")
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestLoadNetRCFileWithNonExistingFile(t *testing.T) {
 	f := filepath.Join(os.TempDir(), "netrctmpfile")
 	os.Setenv("NETRC_PATH", f)
@@ -89,7 +109,7 @@ func TestLogin(t *testing.T) {
 		_, err := netrcFile.Write(body)
 		return err
 	}
-	err := Login()
+	err := Login(context.Background())
 	if err != nil {
 		t.Error(err)
 	}
@@ -135,3 +155,73 @@ func TestLogout(t *testing.T) {
 		t.Error("Expected netrcFile to contain github login")
 	}
 }
+
+func TestConfigureAPITokenSource(t *testing.T) {
+	api.APIImpl = api.NewAPIv1("https://api.example.com/v1", "")
+	orgLoadNetrc, orgHelper := loadNetrc, runCredentialHelper
+	orgAPIKey, orgTokenFile, orgCredentialHelper := config.APIKey, config.TokenFile, config.CredentialHelper
+	defer func() {
+		loadNetrc, runCredentialHelper = orgLoadNetrc, orgHelper
+		config.APIKey, config.TokenFile, config.CredentialHelper = orgAPIKey, orgTokenFile, orgCredentialHelper
+		os.Unsetenv(config.ENV_TOKEN)
+	}()
+	loadNetrc = func() *netrc.Netrc {
+		nrc, _ := netrc.Parse(bytes.NewBufferString("machine api.example.com\n\tlogin batman@example.com\n\tpassword netrc-token"))
+		return nrc
+	}
+	runCredentialHelper = func(helper, host string) (string, error) {
+		return helper + "@" + host, nil
+	}
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// From the lowest to the highest priority
+	tests := []struct {
+		helper, configKey, file, env, flag string
+		expectedKey                        string
+		expectedSource                     TokenSource
+	}{
+		{expectedKey: "netrc-token", expectedSource: TokenFromStore},
+		{helper: "helper", expectedKey: "helper@api.example.com", expectedSource: TokenFromCredentialHelper},
+		{helper: "helper", configKey: "config-token", expectedKey: "config-token", expectedSource: TokenFromConfigFile},
+		{configKey: "config-token", file: tokenFile, expectedKey: "file-token", expectedSource: TokenFromFile},
+		{file: tokenFile, env: "env-token", expectedKey: "env-token", expectedSource: TokenFromEnv},
+		{env: "env-token", flag: "flag-token", expectedKey: "flag-token", expectedSource: TokenFromFlag},
+	}
+	for _, tt := range tests {
+		config.CredentialHelper, config.APIKey, config.TokenFile = tt.helper, tt.configKey, tt.file
+		os.Setenv(config.ENV_TOKEN, tt.env)
+		set := flag.NewFlagSet("test", 0)
+		set.String("token", tt.flag, "")
+		if err := ConfigureAPIToken(cli.NewContext(nil, set, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if api.APIImpl.Key() != tt.expectedKey || CurrentTokenSource != tt.expectedSource {
+			t.Errorf("Expected token %s from %s, got %s from %s", tt.expectedKey, tt.expectedSource, api.APIImpl.Key(), CurrentTokenSource)
+		}
+	}
+
+	config.APIKey, config.TokenFile = "", filepath.Join(t.TempDir(), "missing")
+	os.Unsetenv(config.ENV_TOKEN)
+	if err := ConfigureAPIToken(cli.NewContext(nil, flag.NewFlagSet("test", 0), nil)); err == nil {
+		t.Error("Expected an error when the token file is missing")
+	}
+}
+
+func TestRunCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is needed")
+	}
+	token, err := runCredentialHelper("echo token-for", "api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-for api.example.com" {
+		t.Errorf("Expected the first line printed by the helper, got %q", token)
+	}
+	if _, err := runCredentialHelper("exit 1", "api.example.com"); err == nil {
+		t.Error("Expected an error when the helper fails")
+	}
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/gemnasium/toolbelt/api"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Number of PBKDF2 iterations used to derive the key of new stores
+const encryptedStoreIterations = 210000
+
+// Max number of PBKDF2 iterations accepted when reading a store, so a corrupt
+// file can't hang the CLI
+const encryptedStoreMaxIterations = 10 * encryptedStoreIterations
+
+// encryptedStore keeps the API keys in a file under the user config dir,
+// encrypted with a passphrase (AES-256-GCM, with a key derived from the
+// passphrase with PBKDF2-HMAC-SHA256). The passphrase is asked once per run.
+type encryptedStore struct {
+	path string
+}
+
+// On-disk format of the store
+type encryptedFile struct {
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type storedCredential struct {
+	Login string `json:"login"`
+	Token string `json:"token"`
+}
+
+// Lambda to be overriden in tests
+var encryptedStorePath = func() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = homePath()
+	}
+	return filepath.Join(dir, "gemnasium", "credentials.enc")
+}
+
+// Lambda to be overriden in tests
+var getPassphrase = func(prompt string) (string, error) {
+	return readPassword(prompt)
+}
+
+// Passphrase of the store, once entered
+var passphrase string
+
+var ErrWrongPassphrase = errors.New("credential store: wrong passphrase")
+
+func newEncryptedStore() *encryptedStore {
+	return &encryptedStore{path: encryptedStorePath()}
+}
+
+func (s *encryptedStore) Get(host string) (login, token string, err error) {
+	creds, err := s.load()
+	if err != nil {
+		return "", "", err
+	}
+	c := creds[host]
+	api.AddSecret(c.Token)
+	return c.Login, c.Token, nil
+}
+
+func (s *encryptedStore) Set(host, login, token string) error {
+	creds, err := s.load()
+	if err != nil {
+		return err
+	}
+	creds[host] = storedCredential{Login: login, Token: token}
+	return s.save(creds)
+}
+
+func (s *encryptedStore) Remove(host string) error {
+	creds, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(creds, host)
+	if len(creds) == 0 {
+		// Back to netrc by default
+		err := os.Remove(s.path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return s.save(creds)
+}
+
+func (s *encryptedStore) String() string {
+	return "encrypted store (" + s.path + ")"
+}
+
+// Decrypt the credentials of the store, or return an empty map if it doesn't
+// exist yet
+func (s *encryptedStore) load() (map[string]storedCredential, error) {
+	creds := map[string]storedCredential{}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f encryptedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, errors.New("credential store: invalid file " + s.path)
+	}
+	if passphrase == "" {
+		if passphrase, err = getPassphrase("Enter the passphrase of the credential store: "); err != nil {
+			return nil, err
+		}
+	}
+	gcm, err := newGCM(passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		passphrase = ""
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plaintext, &creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// Encrypt creds in the store, with a new salt and nonce
+func (s *encryptedStore) save(creds map[string]storedCredential) error {
+	if passphrase == "" {
+		p, err := getPassphrase("Choose a passphrase for the credential store: ")
+		if err != nil {
+			return err
+		}
+		confirmation, err := getPassphrase("Confirm the passphrase: ")
+		if err != nil {
+			return err
+		}
+		if p == "" || p != confirmation {
+			return errors.New("credential store: the passphrases are empty or don't match")
+		}
+		passphrase = p
+	}
+	plaintext, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	f := encryptedFile{
+		Iterations: encryptedStoreIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, plaintext, nil)
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	// Replace the store at once, not to lose it if the write is interrupted
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations < encryptedStoreIterations || iterations > encryptedStoreMaxIterations {
+		return nil, fmt.Errorf("credential store: invalid number of iterations: %d", iterations)
+	}
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bgentry/go-netrc/netrc"
+	"github.com/gemnasium/toolbelt/config"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gemnasium", "credentials.enc")
+	orgGetPassphrase := getPassphrase
+	defer func() {
+		getPassphrase = orgGetPassphrase
+		passphrase = ""
+	}()
+	entered := "correct horse battery staple"
+	prompts := 0
+	getPassphrase = func(prompt string) (string, error) {
+		prompts++
+		return entered, nil
+	}
+
+	passphrase = ""
+	store := &encryptedStore{path: path}
+	if err := store.Set("api.gemnasium.com", "batman@example.com", "secret-api-key"); err != nil {
+		t.Fatal(err)
+	}
+	if prompts != 2 {
+		t.Errorf("Expected the new passphrase to be asked and confirmed, got %d prompts", prompts)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-api-key") || strings.Contains(string(data), "batman") {
+		t.Errorf("Credentials are stored in clear: %s", data)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the store to be readable by the user only, got %v", info.Mode())
+	}
+	if tmps, _ := filepath.Glob(path + ".*.tmp"); len(tmps) != 0 {
+		t.Errorf("Expected the temporary files to be removed, got %v", tmps)
+	}
+
+	// A new run asks the passphrase again
+	passphrase = ""
+	login, token, err := store.Get("api.gemnasium.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login != "batman@example.com" || token != "secret-api-key" {
+		t.Errorf("Unexpected credentials: %s, %s", login, token)
+	}
+
+	passphrase = ""
+	entered = "wrong"
+	if _, _, err := store.Get("api.gemnasium.com"); err != ErrWrongPassphrase {
+		t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+	}
+
+	// The store is removed with its last entry
+	entered = "correct horse battery staple"
+	if err := store.Remove("api.gemnasium.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty store to be removed, got %v", err)
+	}
+}
+
+func TestEncryptedStoreIterations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	orgGetPassphrase := getPassphrase
+	defer func() {
+		getPassphrase = orgGetPassphrase
+		passphrase = ""
+	}()
+	getPassphrase = func(prompt string) (string, error) {
+		return "correct horse battery staple", nil
+	}
+
+	// A tampered store can't lower the cost of the key, nor hang the CLI
+	for _, iterations := range []int{0, 1, encryptedStoreIterations - 1, encryptedStoreMaxIterations + 1, 1 << 40} {
+		data, err := json.Marshal(encryptedFile{Iterations: iterations, Salt: make([]byte, 16), Nonce: make([]byte, 12)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		passphrase = ""
+		store := &encryptedStore{path: path}
+		_, _, err = store.Get("api.gemnasium.com")
+		if err == nil || !strings.Contains(err.Error(), "invalid number of iterations") {
+			t.Errorf("%d iterations: expected an invalid number of iterations, got %v", iterations, err)
+		}
+	}
+}
+
+func TestSelectedStore(t *testing.T) {
+	orgStore := config.CredentialStore
+	defer func() { config.CredentialStore = orgStore }()
+
+	config.CredentialStore = ""
+	if store, _ := SelectedStore(); store.String() != (netrcStore{}).String() {
+		t.Errorf("Expected netrc by default, got %s", store)
+	}
+	if err := ioutil.WriteFile(encryptedStorePath(), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(encryptedStorePath())
+	if store, _ := SelectedStore(); !strings.HasPrefix(store.String(), "encrypted store") {
+		t.Errorf("Expected the existing encrypted store by default, got %s", store)
+	}
+	config.CredentialStore = StoreNetrc
+	if store, _ := SelectedStore(); store.String() != (netrcStore{}).String() {
+		t.Errorf("Expected netrc when set, got %s", store)
+	}
+	config.CredentialStore = "keychain"
+	if _, err := SelectedStore(); err == nil {
+		t.Error("Expected an error for an unknown store")
+	}
+}
+
+// Without credential_store, netrc is still looked up for the hosts the
+// encrypted store doesn't hold
+func TestDefaultStoreFallsBackToNetrc(t *testing.T) {
+	orgStore, orgLoadNetrc, orgWriteNetrcFile, orgGetPassphrase := config.CredentialStore, loadNetrc, writeNetrcFile, getPassphrase
+	defer func() {
+		config.CredentialStore, loadNetrc, writeNetrcFile, getPassphrase = orgStore, orgLoadNetrc, orgWriteNetrcFile, orgGetPassphrase
+		passphrase = ""
+		os.Remove(encryptedStorePath())
+	}()
+	netrcFile := "machine api.example.com\n  login robin@example.com\n  password netrc-key\n"
+	loadNetrc = func() *netrc.Netrc {
+		nrc, _ := netrc.Parse(strings.NewReader(netrcFile))
+		return nrc
+	}
+	writeNetrcFile = func(body []byte) error {
+		netrcFile = string(body)
+		return nil
+	}
+	getPassphrase = func(prompt string) (string, error) {
+		return "correct horse battery staple", nil
+	}
+	passphrase = ""
+	if err := newEncryptedStore().Set("api.gemnasium.com", "batman@example.com", "encrypted-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	config.CredentialStore = ""
+	store, err := SelectedStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, expected := range map[string]string{"api.gemnasium.com": "encrypted-key", "api.example.com": "netrc-key"} {
+		if _, token, err := store.Get(host); err != nil || token != expected {
+			t.Errorf("%s: expected token %s, got %q (%v)", host, expected, token, err)
+		}
+	}
+
+	// Logging out removes the key from netrc too
+	if err := store.Remove("api.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, token, err := store.Get("api.example.com"); err != nil || token != "" {
+		t.Errorf("Expected no token after logout, got %q (%v)", token, err)
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// CredentialStore keeps the API keys of the user, per API host
+type CredentialStore interface {
+	// Return the login and API key stored for host, or empty strings
+	Get(host string) (login, token string, err error)
+	Set(host, login, token string) error
+	Remove(host string) error
+	// Description of the store, with its location
+	String() string
+}
+
+// Names of the credential stores, for credential_store and --store
+const (
+	StoreNetrc     = "netrc"
+	StoreEncrypted = "encrypted"
+)
+
+// Return the credential store set with credential_store (or --store).
+// By default, the encrypted store is used if it exists, netrc otherwise,
+// netrc being still looked up for the hosts the encrypted store doesn't hold.
+func SelectedStore() (CredentialStore, error) {
+	switch config.CredentialStore {
+	case StoreNetrc:
+		return netrcStore{}, nil
+	case StoreEncrypted:
+		return newEncryptedStore(), nil
+	case "":
+		if _, err := os.Stat(encryptedStorePath()); err == nil {
+			return fallbackStore{newEncryptedStore(), netrcStore{}}, nil
+		}
+		return netrcStore{}, nil
+	}
+	return nil, fmt.Errorf("Unknown credential store: %s (expected %s or %s)", config.CredentialStore, StoreNetrc, StoreEncrypted)
+}
+
+// fallbackStore keeps the API keys in primary, and looks them up in
+// fallback for the hosts primary doesn't hold. They're removed from both.
+type fallbackStore struct {
+	primary  CredentialStore
+	fallback CredentialStore
+}
+
+func (s fallbackStore) Get(host string) (login, token string, err error) {
+	login, token, err = s.primary.Get(host)
+	if err != nil || token != "" {
+		return login, token, err
+	}
+	return s.fallback.Get(host)
+}
+
+func (s fallbackStore) Set(host, login, token string) error {
+	return s.primary.Set(host, login, token)
+}
+
+func (s fallbackStore) Remove(host string) error {
+	if err := s.primary.Remove(host); err != nil {
+		return err
+	}
+	if _, token, err := s.fallback.Get(host); err != nil || token == "" {
+		return err
+	}
+	return s.fallback.Remove(host)
+}
+
+func (s fallbackStore) String() string {
+	return s.primary.String() + ", then " + s.fallback.String()
+}
+
+// netrcStore keeps the API keys in clear in ~/.netrc, where other tools
+// can read them
+type netrcStore struct{}
+
+func (netrcStore) Get(host string) (login, token string, err error) {
+	nrc := loadNetrc()
+	if nrc == nil {
+		return "", "", nil
+	}
+	m := nrc.FindMachine(host)
+	if m == nil {
+		return "", "", nil
+	}
+	// Keep netrc passwords out of the debug logs
+	api.AddSecret(m.Password)
+	return m.Login, m.Password, nil
+}
+
+func (netrcStore) Set(host, login, token string) error {
+	nrc := loadNetrc()
+	m := nrc.FindMachine(host)
+	if m == nil || m.IsDefault() {
+		m = nrc.NewMachine(host, login, token, "")
+	}
+	m.UpdateLogin(login)
+	m.UpdatePassword(token)
+
+	body, err := nrc.MarshalText()
+	if err != nil {
+		return err
+	}
+	return writeNetrcFile(body)
+}
+
+func (netrcStore) Remove(host string) error {
+	nrc := loadNetrc()
+	nrc.RemoveMachine(host)
+
+	body, err := nrc.MarshalText()
+	if err != nil {
+		return err
+	}
+	return writeNetrcFile(body)
+}
+
+func (netrcStore) String() string {
+	return "netrc (" + netrcPath() + ")"
+}
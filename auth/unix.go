@@ -4,6 +4,7 @@ package auth
 
 import (
 	"os"
+	"os/exec"
 	"syscall"
 )
 
@@ -19,3 +20,8 @@ func sysExec(path string, args []string, env []string) error {
 func homePath() string {
 	return os.Getenv("HOME")
 }
+
+// Run command with sh, passing args as positional parameters
+func shellCommand(command string, args ...string) *exec.Cmd {
+	return exec.Command("sh", append([]string{"-c", command + ` "$@"`, command}, args...)...)
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Where the API token in use comes from, from the lowest to the highest
+// priority
+type TokenSource int
+
+const (
+	NoToken TokenSource = iota
+	TokenFromStore
+	TokenFromCredentialHelper
+	TokenFromConfigFile
+	TokenFromFile
+	TokenFromEnv
+	TokenFromFlag
+)
+
+// Source of the token resolved by ConfigureAPIToken
+var CurrentTokenSource TokenSource
+
+func (s TokenSource) String() string {
+	switch s {
+	case TokenFromStore:
+		if store, err := SelectedStore(); err == nil {
+			return store.String()
+		}
+		return "credential store"
+	case TokenFromCredentialHelper:
+		return "credential_helper (" + config.CredentialHelper + ")"
+	case TokenFromConfigFile:
+		if origin := config.Origin("api_key"); strings.HasPrefix(origin, "file:") {
+			return "api_key in " + strings.TrimPrefix(origin, "file:")
+		}
+		return "api_key in .gemnasium.yml"
+	case TokenFromFile:
+		return "GEMNASIUM_TOKEN_FILE (" + config.TokenFile + ")"
+	case TokenFromEnv:
+		return "GEMNASIUM_TOKEN env var"
+	case TokenFromFlag:
+		return "--token flag"
+	}
+	return "none"
+}
+
+// Print the profile, endpoint, token and token source in use, and the account
+// they give access to. The token is checked against the API: an error is
+// returned if it's missing or invalid, after the details have been printed.
+func WhoAmI(ctx context.Context, w io.Writer) error {
+	table := tablewriter.NewWriter(w)
+	if config.ProfileName != "" {
+		table.Append([]string{"Profile", config.ProfileName})
+	}
+	table.Append([]string{"Endpoint", api.APIImpl.Endpoint()})
+	table.Append([]string{"API version", strconv.Itoa(api.APIImpl.Version())})
+	table.Append([]string{"Token", maskToken(api.APIImpl.Key())})
+	table.Append([]string{"Token source", CurrentTokenSource.String()})
+	if CurrentTokenSource == NoToken {
+		table.Render()
+		return ErrEmptyToken
+	}
+
+	user, err := api.APIImpl.User(ctx)
+	if err != nil {
+		table.Append([]string{"Account", "invalid token"})
+		table.Render()
+		return err
+	}
+	account := "valid token (API v1 doesn't tell the account)"
+	if user.Email != "" {
+		account = fmt.Sprintf("%s <%s>", user.Name, user.Email)
+	}
+	table.Append([]string{"Account", account})
+	table.Render()
+	return nil
+}
+
+// Hide all but the last 4 chars of token
+func maskToken(token string) string {
+	if token == "" {
+		return "none"
+	}
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
@@ -2,7 +2,11 @@
 
 package auth
 
-import "os"
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
 
 const (
 	netrcFilename           = "_netrc"
@@ -16,3 +20,8 @@ func homePath() string {
 	}
 	return home
 }
+
+// Run command with cmd.exe, args appended
+func shellCommand(command string, args ...string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command+" "+strings.Join(args, " "))
+}
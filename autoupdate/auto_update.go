@@ -7,6 +7,7 @@ These functions are meant to be used during CI tests.
 */
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -32,13 +33,13 @@ const (
 var ErrProjectRevisionEmpty error = fmt.Errorf("The current revision (%s) is unknown on Gemnasium, please push your dependency files before running autoupdate.\nSee `gemnasium df help push`.\n", utils.GetCurrentRevision())
 
 // Apply the best dependency files that have been found so far
-func Apply(projectSlug string, testSuite []string) error {
-	err := checkProject(projectSlug)
+func Apply(ctx context.Context, projectSlug string, testSuite []string) error {
+	err := checkProject(ctx, projectSlug)
 	if err != nil {
 		return err
 	}
 
-	dfiles, err := fetchDependencyFiles(projectSlug)
+	dfiles, err := fetchDependencyFiles(ctx, projectSlug)
 	if err != nil {
 		return err
 	}
@@ -54,13 +55,13 @@ func Apply(projectSlug string, testSuite []string) error {
 }
 
 // Fetch the best dependency files that have been found so far
-func fetchDependencyFiles(projectSlug string) (dfiles []api.DependencyFile, err error) {
+func fetchDependencyFiles(ctx context.Context, projectSlug string) (dfiles []api.DependencyFile, err error) {
 	revision, err := getRevision()
 	if err != nil {
 		return nil, err
 	}
 
-	dfiles, err = api.APIImpl.AutoUpdateStepsBest(projectSlug, revision)
+	dfiles, err = api.APIImpl.AutoUpdateStepsBest(ctx, projectSlug, revision)
 	return dfiles, err
 }
 
@@ -80,8 +81,9 @@ func updateDepFiles(dfiles []api.DependencyFile) error {
 }
 
 // Download and loop over update sets, apply changes, run test suite, and finally notify gemnasium
-func Run(projectSlug string, testSuite []string) error {
-	err := checkProject(projectSlug)
+// The loop (and the running test suite) is stopped as soon as ctx is done.
+func Run(ctx context.Context, projectSlug string, testSuite []string) error {
+	err := checkProject(ctx, projectSlug)
 	if err != nil {
 		return err
 	}
@@ -93,7 +95,7 @@ func Run(projectSlug string, testSuite []string) error {
 		return errors.New("Arg [testSuite] can't be empty")
 	}
 
-	out, err := executeTestSuite(testSuite)
+	out, err := executeTestSuite(ctx, testSuite)
 	if err != nil {
 		fmt.Println("Aborting, initial test suite run is failing:")
 		fmt.Printf("%s\n", out)
@@ -102,7 +104,7 @@ func Run(projectSlug string, testSuite []string) error {
 
 	// Loop until tests are green
 	for {
-		updateSet, err := fetchUpdateSet(projectSlug)
+		updateSet, err := fetchUpdateSet(ctx, projectSlug)
 		if err != nil {
 			return err
 		}
@@ -118,7 +120,7 @@ func Run(projectSlug string, testSuite []string) error {
 		resultSet := &api.UpdateSetResult{UpdateSetID: updateSet.ID, ProjectSlug: projectSlug, DependencyFiles: uptDepFiles}
 		if err == cantInstallRequirements || err == cantUpdateVersions {
 			resultSet.State = UPDATE_SET_INVALID
-			err := pushUpdateSetResult(resultSet)
+			err := pushUpdateSetResult(ctx, resultSet)
 			if err != nil {
 				return err
 			}
@@ -134,11 +136,16 @@ func Run(projectSlug string, testSuite []string) error {
 			return err
 		}
 
-		out, err := executeTestSuite(testSuite)
+		out, err := executeTestSuite(ctx, testSuite)
+		if ctx.Err() != nil {
+			// Interrupted, leave the files as they were
+			restoreDepFiles(orgDepFiles)
+			return ctx.Err()
+		}
 		if err == nil {
 			// we found a valid candidate
 			resultSet.State = UPDATE_SET_SUCCESS
-			err := pushUpdateSetResult(resultSet)
+			err := pushUpdateSetResult(ctx, resultSet)
 			if err != nil {
 				return err
 			}
@@ -153,7 +160,7 @@ func Run(projectSlug string, testSuite []string) error {
 		// display cmd output
 		fmt.Printf("%s\n", out)
 		resultSet.State = UPDATE_SET_FAIL
-		err = pushUpdateSetResult(resultSet)
+		err = pushUpdateSetResult(ctx, resultSet)
 		if err != nil {
 			return err
 		}
@@ -166,13 +173,13 @@ func Run(projectSlug string, testSuite []string) error {
 	return nil
 }
 
-func fetchUpdateSet(projectSlug string) (updateSet *api.UpdateSet, err error) {
+func fetchUpdateSet(ctx context.Context, projectSlug string) (updateSet *api.UpdateSet, err error) {
 	revision, err := getRevision()
 	if err != nil {
 		return nil, err
 	}
 
-	updateSet, err = api.APIImpl.AutoUpdateStepsNext(projectSlug, revision)
+	updateSet, err = api.APIImpl.AutoUpdateStepsNext(ctx, projectSlug, revision)
 	return updateSet, err
 }
 
@@ -209,7 +216,7 @@ func applyUpdateSet(updateSet *api.UpdateSet) (orgDepFiles, uptDepFiles []api.De
 
 // Once update set has been tested, we must send the result to Gemnasium,
 // in order to update statitics.
-func pushUpdateSetResult(rs *api.UpdateSetResult) error {
+func pushUpdateSetResult(ctx context.Context, rs *api.UpdateSetResult) error {
 	fmt.Printf("Pushing result (status='%s'): ", rs.State)
 
 	if rs.UpdateSetID == 0 || rs.State == "" {
@@ -221,7 +228,7 @@ func pushUpdateSetResult(rs *api.UpdateSetResult) error {
 		return err
 	}
 
-	err = api.APIImpl.AutoUpdateStepsPush(revision, rs)
+	err = api.APIImpl.AutoUpdateStepsPush(ctx, revision, rs)
 	if err != nil {
 		return err
 	}
@@ -245,7 +252,7 @@ func restoreDepFiles(dfiles []api.DependencyFile) error {
 	return nil
 }
 
-func executeTestSuite(ts []string) ([]byte, error) {
+func executeTestSuite(ctx context.Context, ts []string) ([]byte, error) {
 	type Result struct {
 		Output []byte
 		Err    error
@@ -257,7 +264,7 @@ func executeTestSuite(ts []string) ([]byte, error) {
 	fmt.Printf("Executing test script: ")
 	start := time.Now()
 	go func() {
-		result, err := exec.Command(ts[0], ts[1:]...).Output()
+		result, err := exec.CommandContext(ctx, ts[0], ts[1:]...).Output()
 		done <- Result{result, err}
 	}()
 	var stop bool
@@ -279,9 +286,9 @@ func executeTestSuite(ts []string) ([]byte, error) {
 	return out, err
 }
 
-func checkProject(slug string) error {
+func checkProject(ctx context.Context, slug string) error {
 	p := &api.Project{Slug: slug}
-	err := project.ProjectFetch(p)
+	err := project.ProjectFetch(ctx, p)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package autoupdate
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,8 +11,13 @@ import (
 	"testing"
 
 	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config/configtest"
 )
 
+func TestMain(m *testing.M) {
+	os.Exit(configtest.Run(m))
+}
+
 func TestFetchUpdateSet(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		r.Header.Set("Content-Type", "application/json")
@@ -37,7 +43,7 @@ func TestFetchUpdateSet(t *testing.T) {
 		VersionUpdates: map[string][]api.VersionUpdate{},
 	}
 
-	resultSet, err := fetchUpdateSet("blah")
+	resultSet, err := fetchUpdateSet(context.Background(), "blah")
 	if err != nil {
 		t.Error(err)
 	}
@@ -43,7 +43,10 @@ func NewUpdater(packageType string) (UpdateFunc, error) {
 
 func RubygemsUpdater(versionUpdates []api.VersionUpdate, orgDepFiles, uptDepFiles *[]api.DependencyFile) error {
 	// we're going to update gemfile.lock, let's save it to later restoration
-	gemfileLock := dependency.NewDependencyFile("Gemfile.lock")
+	gemfileLock, err := dependency.NewDependencyFile("Gemfile.lock")
+	if err != nil {
+		return err
+	}
 	*orgDepFiles = append(*orgDepFiles, *gemfileLock)
 
 	upt := BUNDLE_UPDATE_CMD
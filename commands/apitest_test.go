@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api/apitest"
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/gemnasium/toolbelt/config/configtest"
+)
+
+func TestMain(m *testing.M) {
+	// Tests must not probe the real API endpoint
+	detectAPIVersion = func(ctx context.Context, endpoint, key string) int { return 1 }
+	os.Exit(configtest.Run(m))
+}
+
+// Run the app against the fake server srv, and return what has been printed
+// on stdout
+func runApp(t *testing.T, srv *apitest.Server, args ...string) (string, error) {
+	args = append([]string{"--api-version", strconv.Itoa(srv.Version)}, args...)
+	return runAppDetectingVersion(t, srv, args...)
+}
+
+// Same as runApp, without setting --api-version
+func runAppDetectingVersion(t *testing.T, srv *apitest.Server, args ...string) (string, error) {
+	orgEndpoint, orgKey, orgSlug := config.APIEndpoint, config.APIKey, config.ProjectSlug
+	defer func() {
+		config.APIEndpoint, config.APIKey, config.ProjectSlug = orgEndpoint, orgKey, orgSlug
+	}()
+	config.APIEndpoint = srv.URL
+	config.APIKey = srv.APIKey
+
+	old := os.Stdout // keep backup of the real stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		output <- buf.String()
+	}()
+
+	err = App().Run(append([]string{"gemnasium"}, args...))
+	w.Close()
+	os.Stdout = old // restoring the real stdout
+	return <-output, err
+}
+
+// Run the test against a fake server for each API version
+func forEachAPIVersion(t *testing.T, test func(t *testing.T, srv *apitest.Server)) {
+	for _, version := range []int{1, 2} {
+		t.Run("v"+strconv.Itoa(version), func(t *testing.T) {
+			srv := apitest.NewServer(version)
+			defer srv.Close()
+			test(t, srv)
+		})
+	}
+}
@@ -1,14 +1,52 @@
 package commands
 
 import (
-	"github.com/gemnasium/toolbelt/auth"
+	"context"
 	"github.com/gemnasium/toolbelt/config"
 	"github.com/urfave/cli"
 	"github.com/gemnasium/toolbelt/api"
+	"errors"
 	"fmt"
 	"os"
 )
 
+// Lambda to be overriden in tests
+var detectAPIVersion = api.DetectVersion
+
+// Credential store of auth login and logout
+var storeFlag = cli.StringFlag{
+	Name:  "store",
+	Usage: "Credential store: netrc, or encrypted for a passphrase-encrypted file (default: credential_store setting)",
+}
+
+// Set api.APIImpl for config.APIVersion, v1 until the version is detected
+func newAPI(key string) error {
+	switch config.APIVersion {
+	case 0, 1:
+		api.APIImpl = api.NewAPIv1(config.APIEndpoint, key)
+	case 2:
+		api.APIImpl = api.NewAPIv2(config.APIEndpoint, key)
+	default:
+		return fmt.Errorf("Unknown API version: %d, expected 1 or 2", config.APIVersion)
+	}
+	return nil
+}
+
+// Detect the API version if it's not set, probing the endpoint with the
+// token configured, and set api.APIImpl accordingly
+func detectAPIVersionWithToken() error {
+	if config.APIVersion != 0 {
+		return nil
+	}
+	key := api.APIImpl.Key()
+	config.APIVersion = detectAPIVersion(appContext, config.APIEndpoint, key)
+	config.SetOrigin("api_version", "detected")
+	if config.APIVersion == 2 && config.APIEndpoint != config.DEFAULT_API_ENDPOINT && !config.RawFormat {
+		fmt.Printf("Using API v2 for endpoint %s.\n", config.APIEndpoint)
+	}
+	return newAPI(key)
+}
+
 func App() *cli.App {
 	app := cli.NewApp()
 	app.Name = "gemnasium"
@@ -25,34 +63,86 @@ func App() *cli.App {
 			Name:  "raw, r",
 			Usage: "Raw format output",
 		},
+		cli.StringFlag{
+			Name:  "profile",
+			Usage: "Profile of the user config file to use (default: GEMNASIUM_PROFILE or the current profile)",
+		},
 		cli.IntFlag{
 			Name:  "api-version",
-			Usage: "API version to use (default: autodetected)",
+			Usage: "API version to use, 1 or 2 (default: api_version setting, or detected by probing the endpoint)",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "Timeout of each API call, 0 to disable (ex: 30s, 2m)",
+			Value: config.Timeout,
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Trace the API calls on stderr, with credentials redacted",
+		},
+		cli.BoolFlag{
+			Name:  "debug-body",
+			Usage: "Trace the API calls on stderr, bodies included",
+		},
+		cli.BoolFlag{
+			Name:  "no-cache",
+			Usage: "Don't use the cached API responses",
+		},
+		cli.StringFlag{
+			Name:  "record",
+			Usage: "Record the API calls in the given directory, with credentials redacted",
+		},
+		cli.StringFlag{
+			Name:  "replay",
+			Usage: "Replay the API calls recorded in the given directory, without network access",
 		},
 	}
+	var cancel context.CancelFunc
 	app.Before = func(c *cli.Context) error {
+		if config.LoadError != nil {
+			// The config commands help fixing the config files
+			if c.Args().First() != "config" {
+				return config.LoadError
+			}
+			if c.Args().Get(1) != "validate" {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", config.LoadError)
+			}
+		}
+		if c.IsSet("profile") {
+			// Settings of the profile apply before the flags below
+			if err := config.SelectProfile(c.String("profile")); err != nil {
+				return err
+			}
+		}
 		config.RawFormat = c.Bool("raw")
+		if c.IsSet("timeout") {
+			config.Timeout = c.Duration("timeout")
+			config.SetOrigin("timeout", "flag:--timeout")
+		}
+		config.NoCache = config.NoCache || c.Bool("no-cache")
+		config.DebugBodies = config.DebugBodies || c.Bool("debug-body")
+		config.Debug = config.Debug || config.DebugBodies || c.Bool("debug")
+		config.RecordDir = c.String("record")
+		config.ReplayDir = c.String("replay")
+		if config.RecordDir != "" && config.ReplayDir != "" {
+			return errors.New("--record and --replay can't be used together")
+		}
+		appContext, cancel = withInterrupt(context.Background())
 		config.APIVersion = c.Int("api-version")
-		if config.APIVersion == 0 {
-			// Set API version if it was not set by parameters
-			if config.APIEndpoint == config.DEFAULT_API_ENDPOINT {
-				config.APIVersion = 1
-			} else {
-				config.APIVersion = 2
-				if !config.RawFormat {
-					fmt.Printf("Using API v2 for endpoint %s.\n", config.APIEndpoint)
-				}
-			}
+		if config.APIVersion != 0 {
+			config.SetOrigin("api_version", "flag:--api-version")
+		} else {
+			config.APIVersion = config.ConfiguredAPIVersion
 		}
-		switch config.APIVersion {
-		case 1:
-			api.APIImpl = api.NewAPIv1(config.APIEndpoint, config.APIKey)
-		case 2:
-			api.APIImpl = &api.V2ToV1{api.NewAPIv2(config.APIEndpoint, config.APIKey)}
-		default:
-			fmt.Fprintf(os.Stderr, "Unknown API version: %d", config.APIVersion)
+		// When it's not set by parameters or config, the API version is
+		// detected by the commands calling the API, once their token is
+		// known (see detectAPIVersionWithToken)
+		return newAPI(config.APIKey)
+	}
+	app.After = func(c *cli.Context) error {
+		if cancel != nil {
+			cancel()
 		}
-
 		return nil
 	}
 	app.Commands = []cli.Command{
@@ -68,27 +158,42 @@ func App() *cli.App {
 							Name: "with-api-token",
 							Usage: "Log in with your API token (API key in the user profile)",
 						},
+						storeFlag,
 					},
 					Action: Login,
 				},
 				{
 					Name:   "logout",
 					Usage:  "Logout",
+					Flags:  []cli.Flag{storeFlag},
 					Action: Logout,
 				},
+				{
+					Name:    "whoami",
+					Aliases: []string{"status"},
+					Usage:   "Show the endpoint, token source and account in use, and check the token",
+					Action:  WhoAmI,
+				},
 			},
 		},
 		{
 			Name:        "configure",
 			Usage:       "Install configuration for an existing project",
-			Description: "Will create a .gemnasium.yml file in the current directory. This file will be parse if present.\n   Warning: this command will overwrite existing .gemnasium.yml file.\n\n   Arguments: project_slug (the identifier of the project).",
-			Action:      Configure,
+			Description: "Will set the project slug in the .gemnasium.yml file of the project, creating it in the current directory if there's none. The other settings of the file, and its comments, are kept.\n\n   Arguments: project_slug (the identifier of the project). Without it, the project is picked among your projects.",
+			ArgsUsage:   "[project_slug]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "scan",
+					Usage: "Scan the project for dependency files, and offer to add their directories to ignored_paths",
+				},
+			},
+			Action: Configure,
 		},
 		{
 			Name:      "projects",
 			ShortName: "p",
 			Usage:     "Manage current project",
-			Before:    auth.ConfigureAPIToken,
+			Before:    requireAPIToken,
 			Subcommands: []cli.Command{
 				{
 					Name:      "list",
@@ -132,7 +237,13 @@ func App() *cli.App {
 					Name:      "create",
 					ShortName: "c",
 					Usage:     "Create a new project on Gemnasium",
-					Action:    ProjectsCreate,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "team",
+							Usage: "Slug of the team to create the project in (API v2 only, see: gemnasium teams list)",
+						},
+					},
+					Action: ProjectsCreate,
 				},
 				{
 					Name:   "sync",
@@ -141,19 +252,35 @@ func App() *cli.App {
 				},
 			},
 		},
+		{
+			Name:   "teams",
+			Usage:  "Teams of the current user (API v2 only)",
+			Before: requireAPIToken,
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					ShortName: "l",
+					Usage:     "List the teams you can create projects in",
+					Action:    TeamsList,
+				},
+			},
+		},
 		{
 			Name:      "dependencies",
 			ShortName: "d",
 			Usage:     "Dependencies",
-			Before: func(ctx *cli.Context) error {
-				auth.ConfigureAPIToken(ctx)
-				return nil
-			},
+			Before:    configureAPIToken,
 			Subcommands: []cli.Command{
 				{
 					Name:      "list",
 					ShortName: "l",
 					Usage:     "List the first level dependencies of the requested project. Usage: gemnasium dependencies list [project_slug]",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "List the dependencies of all the projects of .gemnasium.yml",
+						},
+					},
 					Action:    DependenciesList,
 				},
 			},
@@ -162,10 +289,6 @@ func App() *cli.App {
 			Name:      "dependency_files",
 			ShortName: "df",
 			Usage:     "Dependency files",
-			Before: func(ctx *cli.Context) error {
-				auth.ConfigureAPIToken(ctx)
-				return nil
-			},
 			Subcommands: []cli.Command{
 				{
 					Name:      "list",
@@ -173,6 +296,18 @@ func App() *cli.App {
 					Usage:     "List dependency files for project",
 					Action:    DependencyFilesList,
 				},
+				{
+					Name:        "ls-local",
+					Usage:       "List the dependency files found locally, and whether they would be pushed",
+					Description: "Search the dependency files like push does without --files, and print the ones selected, and the rule deciding it (ignored_paths, include_paths, excluded_dirs, .gitignore or .gemnasiumignore file).",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "List the files of all the projects of .gemnasium.yml",
+						},
+					},
+					Action: DependencyFilesListLocal,
+				},
 				{
 					Name:      "push",
 					ShortName: "p",
@@ -182,8 +317,20 @@ func App() *cli.App {
 							Name:  "files, f",
 							Usage: "list of files to send, separated with a comma.",
 						},
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "Push the files of all the projects of .gemnasium.yml",
+						},
+						cli.StringFlag{
+							Name:  "revision",
+							Usage: "read the files committed at this git revision, instead of the working tree",
+						},
+						cli.BoolFlag{
+							Name:  "allow-dirty",
+							Usage: "push the files with uncommitted changes, instead of failing",
+						},
 					},
-					Description: "Send files to Gemnasium. If --files is not set, all dependency files supported by Gemnasium found in the current path will be sent to Gemnasium API. You can ignore paths with GEMNASIUM_IGNORED_PATHS",
+					Description: "Send files to Gemnasium. If --files is not set, all dependency files supported by Gemnasium found in the current path will be sent to Gemnasium API. You can ignore paths with GEMNASIUM_IGNORED_PATHS. In a monorepo, the files of the project of the current directory are sent, or the ones of all the projects with --all. With --revision, the files are read from git at this revision, which is pushed instead of the current one, leaving out uncommitted changes. Otherwise, the push fails if files differ from the revision pushed (HEAD, or REVISION) or aren't committed, unless --allow-dirty is set.",
 					Action:      DependenciesPush,
 				},
 			},
@@ -192,15 +339,18 @@ func App() *cli.App {
 			Name:      "alerts",
 			ShortName: "a",
 			Usage:     "Dependency Alerts",
-			Before: func(ctx *cli.Context) error {
-				auth.ConfigureAPIToken(ctx)
-				return nil
-			},
+			Before:    configureAPIToken,
 			Subcommands: []cli.Command{
 				{
 					Name:      "list",
 					ShortName: "l",
 					Usage:     "List the dependency alerts the given project is affected by",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "List the alerts of all the projects of .gemnasium.yml",
+						},
+					},
 					Action:    DependencyAlertsList,
 				},
 			},
@@ -214,6 +364,14 @@ func App() *cli.App {
 					Name:  "files, f",
 					Usage: "list of files to evaluate, separated with a comma.",
 				},
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "Evaluate the files of all the projects of .gemnasium.yml",
+				},
+				cli.StringFlag{
+					Name:  "revision",
+					Usage: "read the files committed at this git revision, instead of the working tree",
+				},
 			},
 			Action: LiveEvaluation,
 		},
@@ -221,7 +379,7 @@ func App() *cli.App {
 			Name:      "autoupdate",
 			ShortName: "au",
 			Usage:     "Auto-update the dependency files of the project",
-			Before:    auth.ConfigureAPIToken,
+			Before:    requireAPIToken,
 			Subcommands: []cli.Command{
 				{
 					Name:      "run",
@@ -273,10 +431,80 @@ func App() *cli.App {
 			},
 		},
 		{
+			// Kept for compatibility, see: config env
 			Name:   "env",
 			Usage:  "Display ENV vars used by gemnasium",
+			Hidden: true,
 			Action: DisplayEnvVars,
 		},
+		{
+			Name:  "config",
+			Usage: "Show and edit the configuration",
+			Description: `The configuration is read from these layers, each one overriding the previous ones:
+   the system config file (/etc/gemnasium/config.yml), the user config file (ex: ~/.config/gemnasium/config.yml),
+   the profile in use, the project config file (.gemnasium.yml), the env vars and the command line flags.`,
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					ShortName: "l",
+					Usage:     "List the effective settings",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "show-origin",
+							Usage: "Show the layer each setting comes from (file, env var, flag or default)",
+						},
+					},
+					Action: ConfigList,
+				},
+				{
+					Name:      "get",
+					Usage:     "Print the effective value of a setting",
+					ArgsUsage: "<key>",
+					Action:    ConfigGet,
+				},
+				{
+					Name:      "set",
+					Usage:     "Set a setting in .gemnasium.yml, or in the user config file with --global",
+					ArgsUsage: "<key> <value>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "global",
+							Usage: "Set it in the user config file, for all the projects",
+						},
+					},
+					Action: ConfigSet,
+				},
+				{
+					Name:      "validate",
+					Usage:     "Check the config files, or the given ones (ex: .gemnasium.yml in CI)",
+					ArgsUsage: "[file...]",
+					Action:    ConfigValidate,
+				},
+				{
+					Name:   "env",
+					Usage:  "Display ENV vars used by gemnasium",
+					Action: DisplayEnvVars,
+				},
+				{
+					Name:  "profiles",
+					Usage: "Manage the profiles of the user config file, to switch between Gemnasium endpoints",
+					Subcommands: []cli.Command{
+						{
+							Name:      "list",
+							ShortName: "l",
+							Usage:     "List the profiles, the one in use being marked with *",
+							Action:    ConfigProfilesList,
+						},
+						{
+							Name:      "use",
+							Usage:     "Make a profile the current one, used when --profile and GEMNASIUM_PROFILE aren't set",
+							ArgsUsage: "<profile>",
+							Action:    ConfigProfilesUse,
+						},
+					},
+				},
+			},
+		},
 	}
 	return app
 }
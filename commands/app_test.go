@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+	"github.com/gemnasium/toolbelt/config"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium-recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { config.RecordDir, config.ReplayDir = "", "" }()
+
+	srv := apitest.NewServer(1)
+	srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah", Description: "Awesome project"}})
+	recorded, err := runApp(t, srv, "--record", dir, "projects", "show", "blah")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	replayed, err := runApp(t, srv, "--replay", dir, "projects", "show", "blah")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(replayed, "Awesome project") || replayed != recorded {
+		t.Errorf("Expected replayed output to match the recorded one:\n%s\ngot:\n%s", recorded, replayed)
+	}
+
+	if _, err := runApp(t, srv, "--record", dir, "--replay", dir, "projects", "show", "blah"); err == nil {
+		t.Error("--record and --replay should not be allowed together")
+	}
+}
+
+func TestAPIVersionDetection(t *testing.T) {
+	orgDetect := detectAPIVersion
+	detectAPIVersion = api.DetectVersion
+	defer func() { detectAPIVersion = orgDetect }()
+
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah"}})
+		if _, err := runAppDetectingVersion(t, srv, "projects", "show", "blah"); err != nil {
+			t.Fatal(err)
+		}
+		if config.APIVersion != srv.Version {
+			t.Errorf("Expected API v%d to be detected, got v%d", srv.Version, config.APIVersion)
+		}
+
+		// --api-version overrides the detection
+		srv.Requests = nil
+		runAppDetectingVersion(t, srv, "--api-version", "1", "projects", "show", "blah")
+		if config.APIVersion != 1 {
+			t.Errorf("Expected API v1 to be forced, got v%d", config.APIVersion)
+		}
+		for _, r := range srv.Requests {
+			if r == "GET /user" {
+				t.Error("The endpoint should not be probed when --api-version is set")
+			}
+		}
+	})
+}
+
+func TestUnknownAPIVersion(t *testing.T) {
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+	_, err := runAppDetectingVersion(t, srv, "--api-version", "3", "projects", "list")
+	if err == nil || !strings.Contains(err.Error(), "Unknown API version: 3") {
+		t.Errorf("Expected an unknown API version error, got %v", err)
+	}
+}
+
+// The API version is detected by the commands calling the API only, with
+// their token wherever it comes from
+func TestAPIVersionDetectedLazily(t *testing.T) {
+	orgDetect := detectAPIVersion
+	defer func() { detectAPIVersion = orgDetect }()
+	var keys []string
+	detectAPIVersion = func(ctx context.Context, endpoint, key string) int {
+		keys = append(keys, key)
+		return 2
+	}
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+
+	for _, args := range [][]string{{"env"}, {"config", "list"}, {"df", "ls-local"}} {
+		if _, err := runAppDetectingVersion(t, srv, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected the offline commands not to detect the API version, got %d detections", len(keys))
+	}
+
+	tokenFile := filepath.Join(os.TempDir(), "gemnasium-token-file")
+	ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600)
+	defer os.Remove(tokenFile)
+	config.TokenFile = tokenFile
+	defer func() { config.TokenFile = "" }()
+	runAppDetectingVersion(t, srv, "projects", "list")
+	if len(keys) != 1 || keys[0] != "file-token" {
+		t.Errorf("Expected the API version to be detected with the token of the token file, got %v", keys)
+	}
+}
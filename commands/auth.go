@@ -1,12 +1,16 @@
 package commands
 
 import (
+	"context"
+	"os"
+
 	"github.com/gemnasium/toolbelt/auth"
+	"github.com/gemnasium/toolbelt/config"
 	"github.com/urfave/cli"
 )
 
-var login = func() error {
-	return auth.Login()
+var login = func(ctx context.Context) error {
+	return auth.Login(ctx)
 }
 
 var login_with_api_token = func(api_token string) error {
@@ -15,13 +19,17 @@ var login_with_api_token = func(api_token string) error {
 
 // auth.Login wrapper with a cli.Content
 func Login(ctx *cli.Context) (err error) {
+	setCredentialStore(ctx)
 	if ctx.IsSet("with-api-token") {
 		// log in with the provided token
 		api_token := ctx.String("with-api-token")
 		err = login_with_api_token(api_token)
 	} else {
 		// log in with the user and password
-		err = login()
+		if err := detectAPIVersionWithToken(); err != nil {
+			return err
+		}
+		err = login(appContext)
 	}
 	return err
 }
@@ -32,6 +40,41 @@ var logout = func() error {
 
 // auth.Logout wrapper with a cli.Content
 func Logout(ctx *cli.Context) error {
+	setCredentialStore(ctx)
 	err := logout()
 	return err
 }
+
+// The --store flag overrides credential_store
+func setCredentialStore(ctx *cli.Context) {
+	if ctx.IsSet("store") {
+		config.CredentialStore = ctx.String("store")
+	}
+}
+
+// Show the endpoint, token and account in use. The token is resolved here,
+// to report where it comes from even when it's missing.
+func WhoAmI(ctx *cli.Context) error {
+	if err := configureAPIToken(ctx); err != nil {
+		return err
+	}
+	return auth.WhoAmI(appContext, os.Stdout)
+}
+
+// Configure the API token like auth.ConfigureAPIToken, a missing token not
+// being an error, but a token that can't be read being one. The API version
+// is then detected with it, if needed.
+func configureAPIToken(ctx *cli.Context) error {
+	if err := auth.ConfigureAPIToken(ctx); err != nil && err != auth.ErrEmptyToken {
+		return err
+	}
+	return detectAPIVersionWithToken()
+}
+
+// Same as configureAPIToken, a missing token being an error
+func requireAPIToken(ctx *cli.Context) error {
+	if err := auth.ConfigureAPIToken(ctx); err != nil {
+		return err
+	}
+	return detectAPIVersionWithToken()
+}
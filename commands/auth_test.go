@@ -1,14 +1,21 @@
 package commands
 
 import (
+	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+	"github.com/gemnasium/toolbelt/config"
 )
 
 func TestLogin(t *testing.T) {
 	var called bool
 	orgLogin := login
-	login = func() error {
+	login = func(ctx context.Context) error {
 		called = true
 		return nil
 	}
@@ -35,3 +42,48 @@ func TestLogout(t *testing.T) {
 		t.Errorf("Should have called login func\n")
 	}
 }
+
+func TestWhoAmI(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		output, err := runApp(t, srv, "--token", srv.APIKey, "auth", "whoami")
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := map[int]string{1: "valid token", 2: apitest.DefaultEmail}[srv.Version]
+		for _, expected := range []string{srv.URL, "| Token source | --token flag", "****3456", account} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+			}
+		}
+		if strings.Contains(output, srv.APIKey) {
+			t.Errorf("The token should be masked, got:\n%s", output)
+		}
+
+		output, err = runApp(t, srv, "--token", "wrong-token", "auth", "status")
+		if !api.IsUnauthorized(err) {
+			t.Errorf("Expected an unauthorized error, got %v", err)
+		}
+		if !strings.Contains(output, "invalid token") {
+			t.Errorf("Expected output to report the invalid token, got:\n%s", output)
+		}
+	})
+}
+
+// A token that can't be read is reported, instead of calling the API without it
+func TestUnreadableTokenFile(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		config.TokenFile = filepath.Join(os.TempDir(), "gemnasium-missing-token")
+		defer func() { config.TokenFile = "" }()
+		commands := [][]string{{"dependencies", "list", "blah"}, {"df", "list"}, {"alerts", "list", "blah"}}
+		if srv.Version == 1 {
+			// Not available on v2
+			commands = append(commands, []string{"eval"}, []string{"autoupdate", "run"})
+		}
+		for _, args := range commands {
+			_, err := runApp(t, srv, args...)
+			if err == nil || !strings.Contains(err.Error(), config.ENV_TOKEN_FILE) {
+				t.Errorf("%v: expected the token file error, got %v", args, err)
+			}
+		}
+	})
+}
@@ -1,48 +1,41 @@
 package commands
 
 import (
-	"github.com/gemnasium/toolbelt/auth"
+	"context"
 	"github.com/gemnasium/toolbelt/autoupdate"
 	"github.com/urfave/cli"
 	"github.com/gemnasium/toolbelt/api"
-	"errors"
 	"github.com/gemnasium/toolbelt/project"
 )
 
-var auRunFunc = func(projectSlug string, args []string) error {
-	return autoupdate.Run(projectSlug, args)
+var auRunFunc = func(ctx context.Context, projectSlug string, args []string) error {
+	return autoupdate.Run(ctx, projectSlug, args)
 }
 
-var auApplyFunc = func(projectSlug string, args []string) error {
-	return autoupdate.Apply(projectSlug, args)
+var auApplyFunc = func(ctx context.Context, projectSlug string, args []string) error {
+	return autoupdate.Apply(ctx, projectSlug, args)
 }
 
 func AutoUpdateRun(ctx *cli.Context) error {
-	// Auto update is not available on API v2
-	switch api.APIImpl.(type) {
-	case *api.V2ToV1:
-		return errors.New("Auto update is not available on API version 2.")
+	if err := api.Require(api.APIImpl, api.FeatureAutoUpdate); err != nil {
+		return err
 	}
-	auth.ConfigureAPIToken(ctx)
 	p, err := project.GetProject(ctx.String("project"))
 	if err != nil {
 		return err
 	}
-	err = auRunFunc(p.Slug, ctx.Args())
+	err = auRunFunc(appContext, p.Slug, ctx.Args())
 	return err
 }
 
 func AutoUpdateApply(ctx *cli.Context) error {
-	// Auto update is not available on API v2
-	switch api.APIImpl.(type) {
-	case *api.V2ToV1:
-		return errors.New("Auto update is not available on API version 2.")
+	if err := api.Require(api.APIImpl, api.FeatureAutoUpdate); err != nil {
+		return err
 	}
-	auth.ConfigureAPIToken(ctx)
 	p, err := project.GetProject(ctx.String("project"))
 	if err != nil {
 		return err
 	}
-	err = auApplyFunc(p.Slug, ctx.Args())
+	err = auApplyFunc(appContext, p.Slug, ctx.Args())
 	return err
 }
@@ -1,7 +1,11 @@
 package commands
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gemnasium/toolbelt/config"
@@ -12,7 +16,7 @@ func TestAutoUpdateRun(t *testing.T) {
 	config.ProjectSlug = "projectSlug"
 
 	var project string
-	auRunFunc = func(slug string, args []string) error {
+	auRunFunc = func(ctx context.Context, slug string, args []string) error {
 		project = slug
 		return nil
 	}
@@ -41,3 +45,29 @@ func TestAutoUpdateRun(t *testing.T) {
 		t.Errorf("Should have called autoupdate func\n")
 	}
 }
+
+// The token is resolved once, by the autoupdate group
+func TestAutoUpdateRunResolvesTokenOnce(t *testing.T) {
+	orgKey, orgHelper, orgVersion, orgRunFunc := config.APIKey, config.CredentialHelper, config.APIVersion, auRunFunc
+	defer func() {
+		config.APIKey, config.CredentialHelper, config.APIVersion, auRunFunc = orgKey, orgHelper, orgVersion, orgRunFunc
+	}()
+	calls := filepath.Join(t.TempDir(), "calls")
+	config.APIKey = ""
+	config.APIVersion = 1
+	config.CredentialHelper = "echo called >> " + calls + "; echo helper-token #"
+	auRunFunc = func(ctx context.Context, slug string, args []string) error {
+		return nil
+	}
+
+	if err := App().Run([]string{"gemnasium", "autoupdate", "run", "-p=slug"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "called"); n != 1 {
+		t.Errorf("Expected the credential helper to run once, ran %d times", n)
+	}
+}
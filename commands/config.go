@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/urfave/cli"
+)
+
+func ConfigProfilesList(ctx *cli.Context) error {
+	err := config.ListProfiles()
+	return err
+}
+
+func ConfigProfilesUse(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		return errors.New("Please give the name of the profile to use")
+	}
+	if err := config.UseProfile(name); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to profile %s\n", name)
+	return nil
+}
+
+func ConfigList(ctx *cli.Context) error {
+	config.List(os.Stdout, ctx.Bool("show-origin"))
+	return nil
+}
+
+func ConfigGet(ctx *cli.Context) error {
+	value, err := config.Get(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func ConfigSet(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		return errors.New("Please give the key and the value of the setting")
+	}
+	return config.Set(ctx.Args().Get(0), ctx.Args().Get(1), ctx.Bool("global"))
+}
+
+func ConfigValidate(ctx *cli.Context) error {
+	if err := config.Validate(ctx.Args()...); err != nil {
+		return err
+	}
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+func DisplayEnvVars(ctx *cli.Context) {
+	config.DisplayEnvVars()
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api/apitest"
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// Use a temp user config file with the profiles "fake", pointing to srv, and
+// "other", the current one
+func withProfiles(t *testing.T, srv *apitest.Server) string {
+	dir, err := ioutil.TempDir("", "gemnasium-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgFile := config.UserConfigFile
+	config.UserConfigFile = filepath.Join(dir, "config.yml")
+	data := fmt.Sprintf(`
+current_profile: other
+profiles:
+  fake:
+    api_endpoint: %s
+    api_version: %d
+    api_key: %s
+  other:
+    api_endpoint: https://gemnasium.example.com/api/v2
+`, srv.URL, srv.Version, srv.APIKey)
+	if err := ioutil.WriteFile(config.UserConfigFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config.UserConfigFile = orgFile
+		os.RemoveAll(dir)
+		config.SelectProfile("")
+	})
+	return config.UserConfigFile
+}
+
+func TestProfileFlag(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		withProfiles(t, srv)
+		output, err := runAppDetectingVersion(t, srv, "--profile", "fake", "auth", "whoami")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"| Profile      | fake ", "| Token source | api_key in ", "(profile fake)"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+			}
+		}
+		// The API version of the profile is used, not the detected one (v1)
+		if !strings.Contains(output, fmt.Sprintf(" %d |\n| Token ", srv.Version)) {
+			t.Errorf("Expected API v%d to be used, got:\n%s", srv.Version, output)
+		}
+
+		if _, err := runApp(t, srv, "--profile", "staging", "auth", "whoami"); err == nil {
+			t.Error("Expected an error for an unknown profile")
+		}
+	})
+}
+
+func TestConfigProfiles(t *testing.T) {
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+	path := withProfiles(t, srv)
+
+	output, err := runApp(t, srv, "--profile", "fake", "config", "profiles", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"| * | fake  | " + srv.URL + " ",
+		"|   | other | https://gemnasium.example.com/api/v2 | detected ",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	if _, err := runApp(t, srv, "config", "profiles", "use", "fake"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "current_profile: fake") {
+		t.Errorf("Expected fake to be the current profile, got:\n%s", data)
+	}
+
+	if _, err := runApp(t, srv, "config", "profiles", "use", "staging"); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+	defer config.SelectProfile("")
+
+	output, err := runApp(t, srv, "--timeout", "2m", "config", "list", "--show-origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"flag:--timeout\ttimeout=2m0s\n",
+		"flag:--api-version\tapi_version=1\n",
+		"default\tretry_max_wait=30s\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+// Until it's detected, the API version is shown as auto, not 0
+func TestConfigListAPIVersionDetected(t *testing.T) {
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+
+	output, err := runAppDetectingVersion(t, srv, "config", "list", "--show-origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "default\tapi_version=auto\n"; !strings.Contains(output, expected) {
+		t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+	}
+}
+
+func TestConfigGetAndSet(t *testing.T) {
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+	path := withProfiles(t, srv)
+	defer os.Remove(config.CONFIG_FILE_PATH)
+
+	if _, err := runApp(t, srv, "config", "set", "retry_max_wait", "20m"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runApp(t, srv, "config", "set", "--global", "retry_wait", "2s"); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{config.CONFIG_FILE_PATH: "retry_max_wait: 20m", path: "retry_wait: 2s"} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %s to contain %q, got:\n%s", file, expected, data)
+		}
+	}
+
+	// The settings are read again by the next run
+	config.SelectProfile("")
+	output, err := runApp(t, srv, "config", "get", "retry_max_wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "20m0s\n" {
+		t.Errorf("Expected retry_max_wait to be 20m0s, got %q", output)
+	}
+
+	if _, err := runApp(t, srv, "config", "set", "timeout", "soon"); err == nil {
+		t.Error("Expected an error for an invalid duration")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "gemnasium-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid, invalid := filepath.Join(dir, "valid.yml"), filepath.Join(dir, "invalid.yml")
+	ioutil.WriteFile(valid, []byte("project_slug: blah\ntimeout: 2m\n"), 0644)
+	ioutil.WriteFile(invalid, []byte("project_slug: blah\ntimout: 2m\n"), 0644)
+
+	output, err := runApp(t, srv, "config", "validate", valid)
+	if err != nil || output != "Configuration is valid\n" {
+		t.Errorf("Expected %s to be valid, got %q, %v", valid, output, err)
+	}
+	_, err = runApp(t, srv, "config", "validate", valid, invalid)
+	if err == nil || err.Error() != invalid+":2: timout: unknown key, did you mean timeout?" {
+		t.Errorf("Expected an unknown key error, got %v", err)
+	}
+}
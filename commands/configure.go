@@ -4,27 +4,24 @@ import (
 	"os"
 
 	"github.com/urfave/cli"
-	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/dependency"
 	"github.com/gemnasium/toolbelt/project"
 )
 
-var confFunc = func(p *api.Project) error {
-	f, err := os.Create(".gemnasium.yml")
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	err = project.ProjectConfigure(p, p.Slug, os.Stdin, f)
-	return err
-}
-
 func Configure(ctx *cli.Context) error {
 	slug := ctx.Args().First()
-	p, err := project.GetProject(slug)
-	if err != nil {
-		return err
+	if slug == "" {
+		// To list the projects to pick from
+		if err := configureAPIToken(ctx); err != nil {
+			return err
+		}
 	}
-
-	err = confFunc(p)
-	return err
+	var dirs []string
+	if ctx.Bool("scan") {
+		var err error
+		if dirs, err = dependency.DependencyDirs(); err != nil {
+			return err
+		}
+	}
+	return project.ProjectConfigure(appContext, slug, dirs, os.Stdin)
 }
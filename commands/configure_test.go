@@ -1,29 +1,36 @@
 package commands
 
 import (
-	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gemnasium/toolbelt/config"
-	"github.com/gemnasium/toolbelt/api"
-	"github.com/gemnasium/toolbelt/project"
 )
 
 func TestConfigue(t *testing.T) {
-	config.APIKey = "abcdef123"
-	config.ProjectSlug = "projectSlug"
-
-	var output bytes.Buffer
-	confFunc = func(p *api.Project) error {
-		return project.ProjectConfigure(p, p.Slug, os.Stdin, &output)
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	orgFile := config.ProjectConfigFile
+	config.ProjectConfigFile = filepath.Join(dir, config.CONFIG_FILE_PATH)
+	defer func() { config.ProjectConfigFile = orgFile }()
+	data := "# Slug of the project\nproject_slug: projectSlug\nignored_paths: [vendor/]\n"
+	if err := ioutil.WriteFile(config.ProjectConfigFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
 	}
-	app := App()
 
-	// Call autoupdate command
+	app := App()
 	os.Args = []string{"gemnasium", "configure", "myProject"}
-	app.Run(os.Args)
-	if output.String() != "project_slug: myProject\n" {
-		t.Errorf("Config file should contain: 'project_slug: MyProject', got: '%s'", output.String())
+	if err := app.Run(os.Args); err != nil {
+		t.Fatal(err)
+	}
+	// The other settings, and the comments, are kept
+	expected := "# Slug of the project\nproject_slug: myProject\nignored_paths: [vendor/]\n"
+	if dat, _ := ioutil.ReadFile(config.ProjectConfigFile); string(dat) != expected {
+		t.Errorf("Config file should contain:\n%s\ngot:\n%s", expected, dat)
 	}
 }
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// Context of the running command, passed to all the API calls.
+// It is set up in App().Before and cancelled when the user hits Ctrl-C.
+var appContext = context.Background()
+
+// Return a copy of parent which is cancelled on SIGINT.
+// A second SIGINT will kill the program as usual.
+func withInterrupt(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
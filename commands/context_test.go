@@ -0,0 +1,21 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithInterrupt(t *testing.T) {
+	ctx, cancel := withInterrupt(context.Background())
+	defer cancel()
+
+	syscall.Kill(os.Getpid(), syscall.SIGINT)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Context should be cancelled on SIGINT")
+	}
+}
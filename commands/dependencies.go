@@ -2,15 +2,18 @@ package commands
 
 import (
 	"github.com/urfave/cli"
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config"
 	"github.com/gemnasium/toolbelt/project"
 	"github.com/gemnasium/toolbelt/dependency"
 )
 
 func DependenciesList(ctx *cli.Context) error {
-	p, err := project.GetProject(ctx.Args().First())
+	projects, err := project.GetProjects(ctx.Args().First(), ctx.Bool("all"))
 	if err != nil {
 		return err
 	}
-	err = dependency.ListDependencies(p)
-	return err
+	return project.ForEach(projects, func(p config.SubProject) error {
+		return dependency.ListDependencies(appContext, &api.Project{Slug: p.Slug})
+	})
 }
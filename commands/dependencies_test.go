@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+)
+
+func TestDependenciesList(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{
+			Project: api.Project{Slug: "blah", Name: "Blah"},
+			Dependencies: []api.Dependency{
+				{Requirement: "=3.1.12", LockedVersion: "3.1.12", Package: api.Package{Name: "rails", Type: "Rubygem"}, FirstLevel: true, Color: "red"},
+			},
+		})
+		output, err := runApp(t, srv, "dependencies", "list", "blah")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "| rails        | =3.1.12      | 3.1.12 | red    |"; !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	})
+}
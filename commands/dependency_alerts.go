@@ -2,16 +2,19 @@ package commands
 
 import (
 	"github.com/urfave/cli"
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config"
 	"github.com/gemnasium/toolbelt/project"
 	"github.com/gemnasium/toolbelt/dependency"
 )
 
 func DependencyAlertsList(ctx *cli.Context) error {
-	p, err := project.GetProject(ctx.Args().First())
+	projects, err := project.GetProjects(ctx.Args().First(), ctx.Bool("all"))
 	if err != nil {
 		return err
 	}
 
-	err = dependency.ListDependencyAlerts(p)
-	return err
+	return project.ForEach(projects, func(p config.SubProject) error {
+		return dependency.ListDependencyAlerts(appContext, &api.Project{Slug: p.Slug})
+	})
 }
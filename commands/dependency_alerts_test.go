@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+)
+
+func TestDependencyAlertsList(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{
+			Project: api.Project{Slug: "blah", Name: "Blah"},
+			Alerts: []api.Alert{
+				{Advisory: api.Advisory{ID: 421}, OpenAt: time.Date(2014, 4, 25, 0, 0, 0, 0, time.UTC), Status: "unacknowledged"},
+			},
+		})
+		output, err := runApp(t, srv, "alerts", "list", "blah")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"421", "25 Apr 14", "unacknowledged"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+			}
+		}
+	})
+}
+
+func TestDependencyAlertsListV2Advisories(t *testing.T) {
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+	srv.AddProject(&apitest.Project{
+		Project: api.Project{Slug: "blah", Name: "Blah"},
+		Alerts: []api.Alert{
+			{Advisory: api.Advisory{Identifier: "CVE-2014-1234", Date: time.Date(2014, 4, 25, 0, 0, 0, 0, time.UTC)}, Status: "open"},
+		},
+	})
+	output, err := runApp(t, srv, "alerts", "list", "blah")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"CVE-2014-1234", "25 Apr 14", "open"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestDependencyAlertsListAll(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		withMonorepo(t)
+		for i, slug := range []string{"root", "rails", "api"} {
+			srv.AddProject(&apitest.Project{
+				Project: api.Project{Slug: slug, Name: slug},
+				Alerts:  []api.Alert{{Advisory: api.Advisory{ID: 420 + i}, Status: "unacknowledged"}},
+			})
+		}
+		output, err := runApp(t, srv, "alerts", "list", "--all")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"==> . (root)", "420", "==> apps/rails (rails)", "421", "==> services/api (api)", "422"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+			}
+		}
+	})
+}
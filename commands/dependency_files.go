@@ -1,32 +1,78 @@
 package commands
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/urfave/cli"
+	"github.com/gemnasium/toolbelt/config"
 	"github.com/gemnasium/toolbelt/project"
 	"github.com/gemnasium/toolbelt/dependency"
+	"github.com/gemnasium/toolbelt/utils"
 )
 
 func DependencyFilesList(ctx *cli.Context) error {
+	if err := configureAPIToken(ctx); err != nil {
+		return err
+	}
 	p, err := project.GetProject()
 	if err != nil {
 		return err
 	}
-	err = dependency.ListDependencyFiles(p)
+	err = dependency.ListDependencyFiles(appContext, p)
 	return err
 }
 
+func DependencyFilesListLocal(ctx *cli.Context) error {
+	projects, err := localProjects(ctx.Bool("all"))
+	if err != nil {
+		return err
+	}
+	return project.ForEach(projects, dependency.ListLocalDependencyFiles)
+}
+
 func DependenciesPush(ctx *cli.Context) error {
-	p, err := project.GetProject()
+	if err := configureAPIToken(ctx); err != nil {
+		return err
+	}
+	files, err := filesFlag(ctx)
 	if err != nil {
 		return err
 	}
-	var files []string
-	if ctx.IsSet("files") {
+	if err := revisionFlag(ctx); err != nil {
+		return err
+	}
+	projects, err := project.GetProjects("", ctx.Bool("all"))
+	if err != nil {
+		return err
+	}
+	return project.ForEach(projects, func(p config.SubProject) error {
+		return dependency.PushDependencyFiles(appContext, p, files, ctx.Bool("allow-dirty"))
+	})
+}
+
+// Return the files given with --files, which can't be used with --all
+func filesFlag(ctx *cli.Context) ([]string, error) {
+	if ctx.String("files") == "" {
 		// Only call strings.Split on non-empty strings, otherwise len(strings) will be 1 instead of 0.
-		files = strings.Split(ctx.String("files"), ",")
+		return nil, nil
 	}
-	err = dependency.PushDependencyFiles(p.Slug, files)
-	return err
+	if ctx.Bool("all") {
+		return nil, errors.New("--files can't be used with --all")
+	}
+	return strings.Split(ctx.String("files"), ","), nil
+}
+
+// Read the dependency files at the revision given with --revision, if any,
+// which is sent as the revision of the push
+func revisionFlag(ctx *cli.Context) error {
+	if ctx.String("revision") == "" {
+		return nil
+	}
+	sha, err := utils.ResolveRevision(ctx.String("revision"))
+	if err != nil {
+		return err
+	}
+	config.Revision = sha
+	return nil
 }
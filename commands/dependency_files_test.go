@@ -0,0 +1,258 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+	"github.com/gemnasium/toolbelt/config"
+)
+
+func TestDependencyFilesList(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{
+			Project: api.Project{Slug: "blah", Name: "Blah"},
+			DependencyFiles: []api.DependencyFile{
+				{Path: "Gemfile.lock", SHA: "Gemfile.lock SHA-1", Content: []byte("GEM")},
+			},
+		})
+		config.ProjectSlug = "blah"
+		output, err := runApp(t, srv, "df", "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "| Gemfile.lock | Gemfile.lock SHA-1 |"; !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	})
+}
+
+func TestDependencyFilesPush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gemfile := filepath.Join(dir, "Gemfile")
+	if err := ioutil.WriteFile(gemfile, []byte("source 'https://rubygems.org'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		p := srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah"}})
+		config.ProjectSlug = "blah"
+		output, err := runApp(t, srv, "df", "push", "--files", gemfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// v1 reports the status of each file, v2 the commit created
+		expected := map[int]string{1: "Added: " + gemfile, 2: "has been pushed."}[srv.Version]
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+		if len(p.DependencyFiles) != 1 {
+			t.Fatalf("Expected 1 dependency file to be pushed, got %d", len(p.DependencyFiles))
+		}
+		df := p.DependencyFiles[0]
+		if df.Path != gemfile || string(df.Content) != "source 'https://rubygems.org'\n" {
+			t.Errorf("Unexpected dependency file pushed: %s %q", df.Path, df.Content)
+		}
+	})
+}
+
+// Use a temp monorepo with a Gemfile at its root and the projects apps/rails
+// and services/api, the current directory being its root
+func withMonorepo(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"Gemfile":                   "source 'https://rubygems.org'\n",
+		"apps/rails/Gemfile":        "gem 'rails'\n",
+		"services/api/package.json": "{}\n",
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	orgDir, orgSlug := config.ProjectDir, config.ProjectSlug
+	config.ProjectDir, config.ProjectSlug = dir, "root"
+	config.Projects = []config.SubProject{
+		{Path: "apps/rails", Slug: "rails"},
+		{Path: "services/api", Slug: "api"},
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+		config.ProjectDir, config.ProjectSlug, config.Projects = orgDir, orgSlug, nil
+	})
+	return dir
+}
+
+func TestDependencyFilesPushAll(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		dir := withMonorepo(t)
+		pushed := map[string]*apitest.Project{}
+		for _, slug := range []string{"root", "rails", "api"} {
+			pushed[slug] = srv.AddProject(&apitest.Project{Project: api.Project{Slug: slug, Name: slug}})
+		}
+		output, err := runApp(t, srv, "df", "push", "--all")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"==> . (root)", "==> apps/rails (rails)", "==> services/api (api)"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+			}
+		}
+		// The files of each project, relative to its directory
+		expected := map[string]string{"root": "Gemfile", "rails": "Gemfile", "api": "package.json"}
+		for slug, path := range expected {
+			if dfiles := pushed[slug].DependencyFiles; len(dfiles) != 1 || dfiles[0].Path != path {
+				t.Errorf("Expected %s to be pushed to %s, got %v", path, slug, dfiles)
+			}
+		}
+
+		// Only the project of the current directory without --all
+		pushed["api"].DependencyFiles = nil
+		os.Chdir(filepath.Join(dir, "services", "api"))
+		output, err = runApp(t, srv, "df", "push")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(output, "==>") || len(pushed["api"].DependencyFiles) != 1 {
+			t.Errorf("Expected the files of services/api only to be pushed, got:\n%s", output)
+		}
+
+		if _, err := runApp(t, srv, "df", "push", "--all", "--files", "Gemfile"); err == nil {
+			t.Error("Expected --files and --all to conflict")
+		}
+	})
+}
+
+// Make dir a git repository, commit its files and return the commit
+func gitCommitAll(t *testing.T, dir string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is required")
+	}
+	var out []byte
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"commit", "-q", "-m", "First"}, {"rev-parse", "HEAD"}} {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		var err error
+		if out, err = cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s\n%s", args, err, out)
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestDependencyFilesPushRevision(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		dir := withMonorepo(t)
+		defer func() { config.Revision = "" }()
+		head := gitCommitAll(t, dir)
+		// Uncommitted changes are left out
+		if err := ioutil.WriteFile(filepath.Join(dir, "Gemfile"), []byte("gem 'uncommitted'\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		p := srv.AddProject(&apitest.Project{Project: api.Project{Slug: "root", Name: "root"}})
+		// The uncommitted changes are left out, so the push isn't dirty
+		if _, err := runApp(t, srv, "df", "push", "--revision", "HEAD"); err != nil {
+			t.Fatal(err)
+		}
+		if len(p.DependencyFiles) != 1 || string(p.DependencyFiles[0].Content) != "source 'https://rubygems.org'\n" {
+			t.Fatalf("Expected the committed Gemfile to be pushed, got %v", p.DependencyFiles)
+		}
+		if srv.Version == 2 && p.CommitSHA != head {
+			t.Errorf("Expected revision %s to be pushed, got %s", head, p.CommitSHA)
+		}
+
+		if _, err := runApp(t, srv, "df", "push", "--revision", "unknown"); err == nil || err.Error() != "Unknown revision: unknown" {
+			t.Errorf("Expected an unknown revision error, got %v", err)
+		}
+	})
+}
+
+func TestDependencyFilesPushDirty(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		dir := withMonorepo(t)
+		first := gitCommitAll(t, dir)
+		p := srv.AddProject(&apitest.Project{Project: api.Project{Slug: "root", Name: "root"}})
+		if _, err := runApp(t, srv, "df", "push"); err != nil {
+			t.Fatal(err)
+		}
+
+		ioutil.WriteFile(filepath.Join(dir, "Gemfile"), []byte("gem 'uncommitted'\n"), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "Gemfile.lock"), []byte("GEM\n"), 0644)
+		p.DependencyFiles = nil
+		_, err := runApp(t, srv, "df", "push")
+		if err == nil || !strings.Contains(err.Error(), "modified: Gemfile\n  untracked: Gemfile.lock\n") {
+			t.Errorf("Expected the push of dirty files to fail, got %v", err)
+		}
+		if len(p.DependencyFiles) != 0 {
+			t.Errorf("Expected no file to be pushed, got %v", p.DependencyFiles)
+		}
+
+		output, err := runApp(t, srv, "df", "push", "--allow-dirty")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(output, "[warning] Pushing uncommitted changes of dependency files:\n  modified: Gemfile\n") {
+			t.Errorf("Expected a warning about the dirty files, got:\n%s", output)
+		}
+		if len(p.DependencyFiles) != 2 {
+			t.Errorf("Expected the dirty files to be pushed, got %v", p.DependencyFiles)
+		}
+
+		// The files are compared with the revision pushed, set with REVISION
+		gitCommitAll(t, dir)
+		defer os.Unsetenv(config.ENV_REVISION)
+		os.Setenv(config.ENV_REVISION, first)
+		_, err = runApp(t, srv, "df", "push")
+		if err == nil || !strings.Contains(err.Error(), "modified: Gemfile\n  untracked: Gemfile.lock\n") {
+			t.Errorf("Expected the files to be compared with REVISION, got %v", err)
+		}
+		os.Setenv(config.ENV_REVISION, "unknown")
+		if _, err = runApp(t, srv, "df", "push"); err == nil || !strings.Contains(err.Error(), "Unknown revision: unknown") {
+			t.Errorf("Expected an unknown revision error, got %v", err)
+		}
+	})
+}
+
+func TestDependencyFilesListLocal(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		withMonorepo(t)
+		config.IncludePaths = []string{"**/*.json"}
+		defer func() { config.IncludePaths = nil }()
+		output, err := runApp(t, srv, "df", "ls-local", "--all")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			"| Gemfile ", "not matched by include_paths",
+			"| apps/rails/ ", "projects: apps/rails",
+			"| package.json | package.json | yes ", "include_paths: **/*.json",
+		} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+			}
+		}
+	})
+}
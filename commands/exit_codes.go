@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/auth"
+)
+
+// Exit codes of the gemnasium command, documented in the README.
+// Scripts can rely on them to tell a bad token from a missing project.
+const (
+	ExitOK           = 0
+	ExitError        = 1   // Any other error (including a red status for `eval`)
+	ExitUnauthorized = 2   // Missing or invalid API token (HTTP 401)
+	ExitForbidden    = 3   // Access denied to the project or resource (HTTP 403)
+	ExitNotFound     = 4   // Project or resource not found (HTTP 404)
+	ExitServerError  = 5   // API unavailable or failing (HTTP 429 and 5xx)
+	ExitTimeout      = 6   // An API call timed out
+	ExitInterrupted  = 130 // Interrupted with Ctrl-C
+)
+
+// Return the exit code matching err
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var netErr net.Error
+	switch {
+	case err == auth.ErrEmptyToken || api.IsUnauthorized(err):
+		return ExitUnauthorized
+	case api.IsForbidden(err):
+		return ExitForbidden
+	case api.IsNotFound(err):
+		return ExitNotFound
+	case api.IsRateLimited(err) || api.IsServerError(err):
+		return ExitServerError
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		return ExitTimeout
+	}
+	return ExitError
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/auth"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestExitCode(t *testing.T) {
+	var tt = []struct {
+		Err      error
+		Expected int
+	}{
+		{nil, ExitOK},
+		{errors.New("boom"), ExitError},
+		{auth.ErrEmptyToken, ExitUnauthorized},
+		{&api.Error{StatusCode: 401}, ExitUnauthorized},
+		{&api.Error{StatusCode: 403}, ExitForbidden},
+		{fmt.Errorf("fetching project: %w", &api.Error{StatusCode: 404}), ExitNotFound},
+		{&api.Error{StatusCode: 429}, ExitServerError},
+		{&api.Error{StatusCode: 503}, ExitServerError},
+		{&api.Error{StatusCode: 422}, ExitError},
+		{&url.Error{Op: "Get", URL: "http://localhost", Err: context.Canceled}, ExitInterrupted},
+		{context.DeadlineExceeded, ExitTimeout},
+		{&url.Error{Op: "Get", URL: "http://localhost", Err: timeoutError{}}, ExitTimeout},
+	}
+	for _, test := range tt {
+		if code := ExitCode(test.Err); code != test.Expected {
+			t.Errorf("ExitCode(%v): expected %d, got %d", test.Err, test.Expected, code)
+		}
+	}
+}
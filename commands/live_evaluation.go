@@ -1,23 +1,44 @@
 package commands
 
 import (
-	"strings"
-
-	"github.com/gemnasium/toolbelt/auth"
+	"github.com/gemnasium/toolbelt/config"
 	"github.com/gemnasium/toolbelt/live-eval"
+	"github.com/gemnasium/toolbelt/project"
 	"github.com/urfave/cli"
 	"github.com/gemnasium/toolbelt/api"
-	"errors"
 )
 
 func LiveEvaluation(ctx *cli.Context) error {
-	// Live evaluation is not available on API v2
-	switch api.APIImpl.(type) {
-	case *api.V2ToV1:
-		return errors.New("Live dependencies evaluation is not available on API version 2.")
+	if err := configureAPIToken(ctx); err != nil {
+		return err
+	}
+	if err := api.Require(api.APIImpl, api.FeatureLiveEval); err != nil {
+		return err
+	}
+	files, err := filesFlag(ctx)
+	if err != nil {
+		return err
+	}
+	if err := revisionFlag(ctx); err != nil {
+		return err
+	}
+	projects := []config.SubProject{{Path: "."}}
+	if len(files) == 0 {
+		// The slugs aren't needed, only the directories of the projects
+		if projects, err = localProjects(ctx.Bool("all")); err != nil {
+			return err
+		}
+	}
+	return project.ForEach(projects, func(p config.SubProject) error {
+		return liveeval.LiveEvaluation(appContext, p, files)
+	})
+}
+
+// Return the projects which local files are searched, which don't need to
+// have a slug outside of a monorepo
+func localProjects(all bool) ([]config.SubProject, error) {
+	if all || len(config.Projects) > 0 {
+		return project.GetProjects("", all)
 	}
-	auth.ConfigureAPIToken(ctx)
-	files := strings.Split(ctx.String("files"), ",")
-	err := liveeval.LiveEvaluation(files)
-	return err
+	return []config.SubProject{{Path: "."}}, nil
 }
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+)
+
+func TestLiveEvaluation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gemfile := filepath.Join(dir, "Gemfile")
+	if err := ioutil.WriteFile(gemfile, []byte("gem 'rails'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+	srv.EvalResult.Result.RuntimeStatus = "green"
+	srv.EvalResult.Result.DevelopmentStatus = "green"
+	srv.EvalResult.Result.Dependencies = []api.Dependency{
+		{Requirement: ">=4.0", LockedVersion: "4.2.0", Package: api.Package{Name: "rails"}, FirstLevel: true, Color: "green"},
+	}
+	output, err := runApp(t, srv, "eval", "--files", gemfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "| rails ") {
+		t.Errorf("Expected output to contain the evaluated dependencies, got:\n%s", output)
+	}
+	if len(srv.EvalJobs) != 1 {
+		t.Fatalf("Expected 1 evaluation job, got %d", len(srv.EvalJobs))
+	}
+	for _, job := range srv.EvalJobs {
+		if len(job.DependencyFiles) != 1 || job.DependencyFiles[0].Path != gemfile {
+			t.Errorf("Unexpected files sent for evaluation: %+v", job.DependencyFiles)
+		}
+	}
+}
+
+func TestLiveEvaluationNotAvailableOnV2(t *testing.T) {
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+	if _, err := runApp(t, srv, "eval", "--files", "Gemfile"); err == nil {
+		t.Error("Live evaluation should fail on API v2")
+	}
+}
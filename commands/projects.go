@@ -6,11 +6,10 @@ import (
 	"github.com/urfave/cli"
 	"github.com/gemnasium/toolbelt/project"
 	"github.com/gemnasium/toolbelt/api"
-	"errors"
 )
 
 func ProjectsList(ctx *cli.Context) error {
-	err := project.ListProjects(ctx.Bool("private"))
+	err := project.ListProjects(appContext, ctx.Bool("private"))
 	return err
 }
 
@@ -20,7 +19,7 @@ func ProjectsShow(ctx *cli.Context) error {
 		return err
 	}
 
-	err = project.ProjectShow(p)
+	err = project.ProjectShow(appContext, p)
 	return err
 }
 
@@ -40,24 +39,20 @@ func ProjectsUpdate(ctx *cli.Context) error {
 		desc = &descString
 	}
 	if ctx.IsSet("monitored") {
-		switch api.APIImpl.(type) {
-		case *api.APIv1:
-			// Ok
-		default:
-			// Monitoring is an API v1 feature only
-			return errors.New("Setting monitored can only be used on API version 1.")
+		if err := api.Require(api.APIImpl, api.FeatureMonitoring); err != nil {
+			return err
 		}
 		mon := ctx.Bool("monitored")
 		monitored = &mon
 	}
-	err = project.ProjectUpdate(p, name, desc, monitored)
+	err = project.ProjectUpdate(appContext, p, name, desc, monitored)
 	return err
 }
 
 func ProjectsCreate(ctx *cli.Context) error {
 	projectName := ctx.Args().First()
 	// will scan from os.Stding if projectName is empty
-	err := project.CreateProject(projectName, os.Stdin)
+	err := project.CreateProject(appContext, projectName, ctx.String("team"), os.Stdin)
 	return err
 }
 
@@ -67,6 +62,6 @@ func ProjectsSync(ctx *cli.Context) error {
 		return err
 	}
 
-	err = project.ProjectSync(p)
+	err = project.ProjectSync(appContext, p)
 	return err
 }
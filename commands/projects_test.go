@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+)
+
+func TestProjectsList(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah"}})
+		srv.AddProject(&apitest.Project{Project: api.Project{Slug: "secret", Name: "Secret", Private: true}})
+		output, err := runApp(t, srv, "projects", "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"| Blah   | blah   |         |", "| Secret | secret | private |", "Found 2 projects"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+			}
+		}
+	})
+}
+
+func TestProjectsShow(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah", Description: "Awesome project"}})
+		output, err := runApp(t, srv, "projects", "show", "blah")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(output, "Awesome project") {
+			t.Errorf("Expected output to contain the description, got:\n%s", output)
+		}
+
+		_, err = runApp(t, srv, "projects", "show", "unknown")
+		if !api.IsNotFound(err) {
+			t.Errorf("Expected a not found error, got %v", err)
+		}
+	})
+}
+
+func TestProjectsShowVersionSpecificDetails(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah", CommitSHA: "abcdef", Branch: "master"}})
+		output, err := runApp(t, srv, "projects", "show", "blah")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Monitoring is v1 only, teams and branches are v2 only
+		if strings.Contains(output, "Monitored") != (srv.Version == 1) {
+			t.Errorf("Expected monitoring to be shown with v1 only, got:\n%s", output)
+		}
+		if strings.Contains(output, apitest.DefaultTeam) != (srv.Version == 2) {
+			t.Errorf("Expected team to be shown with v2 only, got:\n%s", output)
+		}
+		if strings.Contains(output, "abcdef (master)") != (srv.Version == 2) {
+			t.Errorf("Expected branch to be shown with v2 only, got:\n%s", output)
+		}
+	})
+}
+
+func TestProjectsUpdate(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		p := srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah"}})
+		if _, err := runApp(t, srv, "projects", "update", "--name", "Blih", "--desc", "Updated", "blah"); err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != "Blih" || p.Description != "Updated" {
+			t.Errorf("Project has not been updated: %+v", p.Project)
+		}
+	})
+}
+
+func TestProjectsCreate(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		output, err := runApp(t, srv, "projects", "create", "Blah")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(srv.Projects) != 1 {
+			t.Fatalf("Expected 1 project to be created, got %d", len(srv.Projects))
+		}
+		for slug, p := range srv.Projects {
+			if p.Name != "Blah" {
+				t.Errorf("Expected project name to be Blah, got %s", p.Name)
+			}
+			if !strings.Contains(output, slug) {
+				t.Errorf("Expected output to contain the slug %q, got:\n%s", slug, output)
+			}
+		}
+	})
+}
+
+func TestProjectsCreateInTeam(t *testing.T) {
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+	srv.Teams = append(srv.Teams, api.V2Team{Slug: "justice-league", Owner: api.V2User{Name: "Clark"}})
+
+	if _, err := runApp(t, srv, "projects", "create", "--team", "justice-league", "Blah"); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Projects) != 1 {
+		t.Fatalf("Expected 1 project to be created, got %d", len(srv.Projects))
+	}
+	for _, p := range srv.Projects {
+		if p.Team != "justice-league" {
+			t.Errorf("Expected project to be created in justice-league, got %s", p.Team)
+		}
+	}
+}
+
+func TestProjectsSync(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		p := srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah"}})
+		if _, err := runApp(t, srv, "projects", "sync", "blah"); err != nil {
+			t.Fatal(err)
+		}
+		if p.SyncCount != 1 {
+			t.Errorf("Expected project to be synced once, got %d", p.SyncCount)
+		}
+	})
+}
+
+func TestProjectsWithWrongToken(t *testing.T) {
+	forEachAPIVersion(t, func(t *testing.T, srv *apitest.Server) {
+		srv.AddProject(&apitest.Project{Project: api.Project{Slug: "blah", Name: "Blah"}})
+		_, err := runApp(t, srv, "--token", "wrong", "projects", "show", "blah")
+		if ExitCode(err) != ExitUnauthorized {
+			t.Errorf("Expected exit code %d, got %d (%v)", ExitUnauthorized, ExitCode(err), err)
+		}
+	})
+}
@@ -0,0 +1,11 @@
+package commands
+
+import (
+	"github.com/gemnasium/toolbelt/team"
+	"github.com/urfave/cli"
+)
+
+func TeamsList(ctx *cli.Context) error {
+	err := team.ListTeams(appContext)
+	return err
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+)
+
+func TestTeamsList(t *testing.T) {
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+	srv.Teams = append(srv.Teams, api.V2Team{Slug: "justice-league", Owner: api.V2User{Name: "Clark"}})
+	output, err := runApp(t, srv, "teams", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"| batcave ", "| justice-league | Clark "} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestTeamsListNotAvailableOnV1(t *testing.T) {
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+	if _, err := runApp(t, srv, "teams", "list"); err == nil {
+		t.Error("Listing teams should fail on API v1")
+	}
+}
@@ -2,22 +2,53 @@ package config
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
-
-	"gopkg.in/yaml.v1"
+	"time"
 )
 
 var (
-	APIEndpoint   = DEFAULT_API_ENDPOINT
-	APIKey       string
-	APIVersion   int = 1
-	ProjectSlug  string
-	IgnoredPaths []string
-	RawFormat    bool
+	APIEndpoint        = DEFAULT_API_ENDPOINT
+	APIKey             string
+	APIVersion         int = 1
+	ProjectSlug        string
+	IgnoredPaths       []string
+	IncludePaths       []string
+	ExcludedDirs       = DEFAULT_EXCLUDED_DIRS
+	RawFormat          bool
+	MaxRetries         = DEFAULT_MAX_RETRIES
+	RetryWait          = DEFAULT_RETRY_WAIT
+	RetryMaxWait       = DEFAULT_RETRY_MAX_WAIT
+	Timeout            = DEFAULT_TIMEOUT
+	RecordDir          string
+	ReplayDir          string
+	CacheDir           string
+	CacheTTL           = DEFAULT_CACHE_TTL
+	NoCache            bool
+	Debug              bool
+	DebugBodies        bool
+	CAFile             string
+	ClientCert         string
+	ClientKey          string
+	InsecureSkipVerify bool
+	ProxyURL           string
+	TokenFile          string
+	CredentialHelper   string
+	CredentialStore    string
 )
 
+// API version set in a config file or profile, 0 to detect it
+var ConfiguredAPIVersion int
+
+// Commit the dependency files are read from, set with --revision. They're
+// read from the working tree when empty.
+var Revision string
+
+// Names of the directories never searched for dependency files
+var DEFAULT_EXCLUDED_DIRS = []string{"node_modules", ".bundle", "vendor", ".git"}
+
 const (
 	VERSION          = "1.0.3"
 	CONFIG_FILE_PATH = ".gemnasium.yml"
@@ -29,17 +60,64 @@ const (
 	ENV_BRANCH                       = "BRANCH"
 	ENV_REVISION                     = "REVISION"
 	ENV_IGNORED_PATHS                = "GEMNASIUM_IGNORED_PATHS"
+	ENV_INCLUDE_PATHS                = "GEMNASIUM_INCLUDE_PATHS"
+	ENV_EXCLUDED_DIRS                = "GEMNASIUM_EXCLUDED_DIRS"
 	ENV_RAW_FORMAT                   = "GEMNASIUM_RAW_FORMAT"
 	ENV_GEMNASIUM_TESTSUITE          = "GEMNASIUM_TESTSUITE"
 	ENV_GEMNASIUM_BUNDLE_INSTALL_CMD = "GEMNASIUM_BUNDLE_INSTALL_CMD"
 	ENV_GEMNASIUM_BUNDLE_UPDATE_CMD  = "GEMNASIUM_BUNDLE_UPDATE_CMD"
+	ENV_MAX_RETRIES                  = "GEMNASIUM_MAX_RETRIES"
+	ENV_RETRY_WAIT                   = "GEMNASIUM_RETRY_WAIT"
+	ENV_RETRY_MAX_WAIT               = "GEMNASIUM_RETRY_MAX_WAIT"
+	ENV_TIMEOUT                      = "GEMNASIUM_TIMEOUT"
+	ENV_CACHE_DIR                    = "GEMNASIUM_CACHE_DIR"
+	ENV_CACHE_TTL                    = "GEMNASIUM_CACHE_TTL"
+	ENV_NO_CACHE                     = "GEMNASIUM_NO_CACHE"
+	ENV_DEBUG                        = "GEMNASIUM_DEBUG"
+	ENV_CA_FILE                      = "GEMNASIUM_CA_FILE"
+	ENV_CLIENT_CERT                  = "GEMNASIUM_CLIENT_CERT"
+	ENV_CLIENT_KEY                   = "GEMNASIUM_CLIENT_KEY"
+	ENV_INSECURE_SKIP_VERIFY         = "GEMNASIUM_INSECURE_SKIP_VERIFY"
+	ENV_PROXY_URL                    = "GEMNASIUM_PROXY_URL"
+	ENV_TOKEN_FILE                   = "GEMNASIUM_TOKEN_FILE"
+	ENV_CREDENTIAL_HELPER            = "GEMNASIUM_CREDENTIAL_HELPER"
+	ENV_CREDENTIAL_STORE             = "GEMNASIUM_CREDENTIAL_STORE"
+	ENV_PROFILE                      = "GEMNASIUM_PROFILE"
 
-	DEFAULT_API_ENDPOINT = "https://api.gemnasium.com/v1"
+	DEFAULT_API_ENDPOINT   = "https://api.gemnasium.com/v1"
+	DEFAULT_MAX_RETRIES    = 3
+	DEFAULT_RETRY_WAIT     = 1 * time.Second
+	DEFAULT_RETRY_MAX_WAIT = 30 * time.Second
+	DEFAULT_TIMEOUT        = 60 * time.Second
+	DEFAULT_CACHE_TTL      = 5 * time.Minute
 )
 
+// Error loading the config files, reported when running a command, so that
+// `config validate` can report it too
+var LoadError error
+
 func init() {
-	loadConfig()
-	loadEnv() // Env will override config file
+	LoadError = load()
+}
+
+// Load the system and user config files, the selected profile of the user
+// config file, the project config file, then the env vars, each one
+// overriding the previous ones.
+func load() error {
+	origins = map[string]string{}
+	if err := loadFile(SystemConfigFile, nil); err != nil {
+		return err
+	}
+	if err := loadFile(UserConfigFile, userConfigKeys); err != nil {
+		return err
+	}
+	if err := loadProfile(); err != nil {
+		return err
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	return loadEnv() // Env will override config file
 }
 
 func getEnvOrElse(name, defaultValue string) string {
@@ -50,45 +128,95 @@ func getEnvOrElse(name, defaultValue string) string {
 	return value
 }
 
-func loadConfig() {
-	dat, err := ioutil.ReadFile(CONFIG_FILE_PATH)
+// Read the config file at path and apply its settings, extraKeys being
+// allowed besides the settings. A missing file is ignored.
+func loadFile(path string, extraKeys []string) error {
+	c, err := readConfigFile(path)
 	if err != nil {
-		return
+		return err
 	}
-	//fmt.Println("Reading config file")
-	c := make(map[string]interface{})
-	err = yaml.Unmarshal(dat, &c)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	s, errs := decodeSettings(c, path, extraKeys)
+	if len(errs) > 0 {
+		return errs
 	}
+	s.resolvePaths(filepath.Dir(path))
+	s.apply("file:" + path)
+	return nil
+}
 
-	if api_endpoint, ok := c["api_endpoint"]; ok {
-		APIEndpoint = api_endpoint.(string)
-	}
-	if api_key, ok := c["api_key"]; ok {
-		APIKey = api_key.(string)
-	}
-	if project_slug, ok := c["project_slug"]; ok {
-		ProjectSlug = project_slug.(string)
+// Errors of the env vars, reported by Validate too
+var envErrors ConfigErrors
+
+// Apply the settings of the env vars. Invalid values are skipped and
+// returned as errors.
+func loadEnv() error {
+	envErrors = nil
+	fail := func(name string, err error) {
+		envErrors = append(envErrors, &ConfigError{Path: "env:" + name, Msg: err.Error()})
 	}
-	if ignored_paths, ok := c["ignored_paths"]; ok {
-		for _, ip := range ignored_paths.([]interface{}) {
-			IgnoredPaths = append(IgnoredPaths, ip.(string))
+	duration := func(name string, d *time.Duration) {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				fail(name, err)
+				return
+			}
+			*d = parsed
 		}
 	}
-}
-
-func loadEnv() {
 	APIEndpoint = getEnvOrElse(ENV_API_ENDDPOINT, APIEndpoint)
 	APIKey = getEnvOrElse(ENV_TOKEN, APIKey)
 	ProjectSlug = getEnvOrElse(ENV_PROJECT_SLUG, ProjectSlug)
 	if ip := os.Getenv(ENV_IGNORED_PATHS); ip != "" {
 		IgnoredPaths = strings.Split(ip, ",")
 	}
+	if ip := os.Getenv(ENV_INCLUDE_PATHS); ip != "" {
+		IncludePaths = strings.Split(ip, ",")
+	}
+	if ed := os.Getenv(ENV_EXCLUDED_DIRS); ed != "" {
+		ExcludedDirs = strings.Split(ed, ",")
+	}
 	if raw := os.Getenv(ENV_RAW_FORMAT); raw != "" {
 		RawFormat = true
 	}
+	if mr := os.Getenv(ENV_MAX_RETRIES); mr != "" {
+		if n, err := strconv.Atoi(mr); err != nil {
+			fail(ENV_MAX_RETRIES, err)
+		} else {
+			MaxRetries = n
+		}
+	}
+	duration(ENV_RETRY_WAIT, &RetryWait)
+	duration(ENV_RETRY_MAX_WAIT, &RetryMaxWait)
+	duration(ENV_TIMEOUT, &Timeout)
+	CacheDir = getEnvOrElse(ENV_CACHE_DIR, CacheDir)
+	duration(ENV_CACHE_TTL, &CacheTTL)
+	if nc := os.Getenv(ENV_NO_CACHE); nc != "" {
+		NoCache = true
+	}
+	switch os.Getenv(ENV_DEBUG) {
+	case "":
+	case "body":
+		Debug, DebugBodies = true, true
+	default:
+		Debug = true
+	}
+	CAFile = getEnvOrElse(ENV_CA_FILE, CAFile)
+	ClientCert = getEnvOrElse(ENV_CLIENT_CERT, ClientCert)
+	ClientKey = getEnvOrElse(ENV_CLIENT_KEY, ClientKey)
+	if isv := os.Getenv(ENV_INSECURE_SKIP_VERIFY); isv != "" {
+		if b, err := strconv.ParseBool(isv); err != nil {
+			fail(ENV_INSECURE_SKIP_VERIFY, err)
+		} else {
+			InsecureSkipVerify = b
+		}
+	}
+	ProxyURL = getEnvOrElse(ENV_PROXY_URL, ProxyURL)
+	TokenFile = getEnvOrElse(ENV_TOKEN_FILE, TokenFile)
+	CredentialHelper = getEnvOrElse(ENV_CREDENTIAL_HELPER, CredentialHelper)
+	CredentialStore = getEnvOrElse(ENV_CREDENTIAL_STORE, CredentialStore)
+	loadEnvOrigins()
+	return envErrors.err()
 }
 
 func DisplayEnvVars() {
@@ -98,11 +226,30 @@ func DisplayEnvVars() {
 		ENV_PROJECT_SLUG:                 "The project slug (unique identifier). Use `gemnasium projects list`, or the project settings page to get it.",
 		ENV_BRANCH:                       "Current branch.",
 		ENV_REVISION:                     "Current revision.",
-		ENV_IGNORED_PATHS:                "When using the 'eval' or 'df push' commands, if --files is empty, gemnasium will look for files locally. Paths to be ignored can be set with this var, separated with a comma.",
+		ENV_IGNORED_PATHS:                "When using the 'eval' or 'df push' commands, if --files is empty, gemnasium will look for files locally. Paths to be ignored can be set with this var, separated with a comma (ex: spec/**/Gemfile).",
+		ENV_INCLUDE_PATHS:                "When searching dependency files locally, only select the ones matching these paths, separated with a comma (ex: services/*/,Gemfile.lock). ** matches any number of directories.",
+		ENV_EXCLUDED_DIRS:                "Names of the directories never searched for dependency files, at any level, separated with a comma. default: node_modules,.bundle,vendor,.git",
 		ENV_RAW_FORMAT:                   "Display raw json response from API server.",
 		ENV_GEMNASIUM_TESTSUITE:          "Used for auto-update command, to set the testsuite to run.",
 		ENV_GEMNASIUM_BUNDLE_INSTALL_CMD: "[auto-update] Override command used with ruby sets. default: 'bundle install'",
 		ENV_GEMNASIUM_BUNDLE_UPDATE_CMD:  "[auto-update] Override command used with ruby sets. default: 'bundle update'",
+		ENV_MAX_RETRIES:                  "Number of retries of idempotent API calls on transient failures (429, 502, 503, 504, connection reset). default: 3",
+		ENV_RETRY_WAIT:                   "Wait before the first retry, doubled on each retry (ex: 500ms, 2s). default: 1s",
+		ENV_RETRY_MAX_WAIT:               "Maximum wait between two retries, Retry-After included. default: 30s",
+		ENV_TIMEOUT:                      "Timeout of each API call, 0 to disable (ex: 30s, 2m). Overridden by --timeout. default: 60s",
+		ENV_CACHE_DIR:                    "Directory of the API responses cache. default: 'gemnasium' in the user cache dir (ex: ~/.cache/gemnasium)",
+		ENV_CACHE_TTL:                    "Cached API responses younger than this are used without asking the API, older ones are revalidated (ex: 0, 10m). default: 5m",
+		ENV_NO_CACHE:                     "Disable the API responses cache, like --no-cache.",
+		ENV_CA_FILE:                      "PEM bundle of the CAs to trust for the API endpoint, in addition to the system ones.",
+		ENV_CLIENT_CERT:                  "PEM client certificate, for API endpoints requiring mutual TLS. Needs GEMNASIUM_CLIENT_KEY.",
+		ENV_CLIENT_KEY:                   "PEM private key of the client certificate.",
+		ENV_INSECURE_SKIP_VERIFY:         "Don't verify the certificate of the API endpoint (true/false). Unsafe, for testing only.",
+		ENV_PROXY_URL:                    "Proxy for the API calls (ex: http://proxy.example.com:3128). default: HTTPS_PROXY/HTTP_PROXY",
+		ENV_DEBUG:                        "Trace the API calls on stderr, like --debug. Set to 'body' to trace the bodies too, like --debug-body.",
+		ENV_TOKEN_FILE:                   "File containing your private API token (ex: a Docker or Kubernetes secret). Overridden by GEMNASIUM_TOKEN.",
+		ENV_CREDENTIAL_HELPER:            "Command printing your API token on stdout, given the API host as argument. Used when no other token is set.",
+		ENV_CREDENTIAL_STORE:             "Where 'auth login' stores your API token: 'netrc' or 'encrypted' (passphrase-encrypted file in the user config dir). default: 'encrypted' if it exists, 'netrc' otherwise",
+		ENV_PROFILE:                      "Profile of the user config file to use (see: gemnasium config profiles list). Overridden by --profile. default: the current profile",
 	}
 	for k, _ := range vars {
 		fmt.Printf("%s=%s\n", k, os.Getenv(k))
@@ -4,7 +4,9 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -25,6 +27,21 @@ ignored_paths:                # Paths you want to ignore when searching for depe
   - test/
   - tmp/
   - vendor/
+max_retries: 5
+retry_wait: 500ms
+retry_max_wait: 1m
+timeout: 90s
+cache_dir: /tmp/gemnasium-cache
+cache_ttl: 1h
+ca_file: /etc/ssl/internal-ca.pem
+client_cert: /etc/ssl/client.pem
+client_key: /etc/ssl/client-key.pem
+insecure_skip_verify: true
+proxy_url: http://proxy.example.com:3128
+credential_helper: pass show gemnasium
+credential_store: encrypted
+api_version: 2
+token_file: /run/secrets/gemnasium_token
 `)
 	err := ioutil.WriteFile(CONFIG_FILE_PATH, configData, 0666)
 	if err != nil {
@@ -53,6 +70,51 @@ ignored_paths:                # Paths you want to ignore when searching for depe
 	if !reflect.DeepEqual(IgnoredPaths, ignored_paths) {
 		t.Errorf("IgnoredPaths doesn't match. Expected: %v, got %v", ignored_paths, IgnoredPaths)
 	}
+	if MaxRetries != 5 {
+		t.Errorf("MaxRetries should be 5, was %d", MaxRetries)
+	}
+	if RetryWait != 500*time.Millisecond {
+		t.Errorf("RetryWait should be 500ms, was %s", RetryWait)
+	}
+	if RetryMaxWait != time.Minute {
+		t.Errorf("RetryMaxWait should be 1m, was %s", RetryMaxWait)
+	}
+	if Timeout != 90*time.Second {
+		t.Errorf("Timeout should be 90s, was %s", Timeout)
+	}
+	if CacheDir != "/tmp/gemnasium-cache" {
+		t.Errorf("CacheDir should be '/tmp/gemnasium-cache', was %s", CacheDir)
+	}
+	if CacheTTL != time.Hour {
+		t.Errorf("CacheTTL should be 1h, was %s", CacheTTL)
+	}
+	if CAFile != "/etc/ssl/internal-ca.pem" {
+		t.Errorf("CAFile should be '/etc/ssl/internal-ca.pem', was %s", CAFile)
+	}
+	if ClientCert != "/etc/ssl/client.pem" || ClientKey != "/etc/ssl/client-key.pem" {
+		t.Errorf("Unexpected ClientCert and ClientKey: %s, %s", ClientCert, ClientKey)
+	}
+	if !InsecureSkipVerify {
+		t.Error("InsecureSkipVerify should be true")
+	}
+	if ProxyURL != "http://proxy.example.com:3128" {
+		t.Errorf("ProxyURL should be 'http://proxy.example.com:3128', was %s", ProxyURL)
+	}
+	if CredentialHelper != "pass show gemnasium" {
+		t.Errorf("CredentialHelper should be 'pass show gemnasium', was %s", CredentialHelper)
+	}
+	if CredentialStore != "encrypted" {
+		t.Errorf("CredentialStore should be 'encrypted', was %s", CredentialStore)
+	}
+	if ConfiguredAPIVersion != 2 {
+		t.Errorf("ConfiguredAPIVersion should be 2, was %d", ConfiguredAPIVersion)
+	}
+	if TokenFile != "/run/secrets/gemnasium_token" {
+		t.Errorf("TokenFile should be '/run/secrets/gemnasium_token', was %s", TokenFile)
+	}
+	if Origin("api_key") != "file:"+CONFIG_FILE_PATH {
+		t.Errorf("api_key should come from file:%s, was %s", CONFIG_FILE_PATH, Origin("api_key"))
+	}
 }
 
 func TestWithEnvVars(t *testing.T) {
@@ -61,6 +123,18 @@ func TestWithEnvVars(t *testing.T) {
 	os.Setenv(ENV_PROJECT_SLUG, "new-slug")
 	os.Setenv(ENV_IGNORED_PATHS, "/tmp,/foo,/bar")
 	os.Setenv(ENV_RAW_FORMAT, "true")
+	os.Setenv(ENV_MAX_RETRIES, "0")
+	os.Setenv(ENV_RETRY_WAIT, "2s")
+	os.Setenv(ENV_RETRY_MAX_WAIT, "10s")
+	os.Setenv(ENV_TIMEOUT, "0")
+	os.Setenv(ENV_CACHE_DIR, "/tmp/cache")
+	os.Setenv(ENV_CACHE_TTL, "0")
+	os.Setenv(ENV_NO_CACHE, "1")
+	os.Setenv(ENV_DEBUG, "body")
+	os.Setenv(ENV_CA_FILE, "/tmp/ca.pem")
+	os.Setenv(ENV_INSECURE_SKIP_VERIFY, "false")
+	os.Setenv(ENV_PROXY_URL, "http://localhost:8080")
+	os.Setenv(ENV_TOKEN_FILE, "/run/secrets/gemnasium_token")
 
 	loadEnv()
 	if APIKey != "new-key" {
@@ -76,4 +150,78 @@ func TestWithEnvVars(t *testing.T) {
 	if !reflect.DeepEqual(IgnoredPaths, ignored_paths) {
 		t.Errorf("IgnoredPaths doesn't match. Expected: %v, got %v", ignored_paths, IgnoredPaths)
 	}
+	if MaxRetries != 0 {
+		t.Errorf("MaxRetries should be 0, was %d", MaxRetries)
+	}
+	if RetryWait != 2*time.Second {
+		t.Errorf("RetryWait should be 2s, was %s", RetryWait)
+	}
+	if RetryMaxWait != 10*time.Second {
+		t.Errorf("RetryMaxWait should be 10s, was %s", RetryMaxWait)
+	}
+	if Timeout != 0 {
+		t.Errorf("Timeout should be 0, was %s", Timeout)
+	}
+	if CacheDir != "/tmp/cache" {
+		t.Errorf("CacheDir should be '/tmp/cache', was %s", CacheDir)
+	}
+	if CacheTTL != 0 {
+		t.Errorf("CacheTTL should be 0, was %s", CacheTTL)
+	}
+	if !NoCache {
+		t.Error("NoCache should be true")
+	}
+	if !Debug || !DebugBodies {
+		t.Error("Debug and DebugBodies should be true")
+	}
+	if CAFile != "/tmp/ca.pem" {
+		t.Errorf("CAFile should be '/tmp/ca.pem', was %s", CAFile)
+	}
+	if InsecureSkipVerify {
+		t.Error("InsecureSkipVerify should be false")
+	}
+	if ProxyURL != "http://localhost:8080" {
+		t.Errorf("ProxyURL should be 'http://localhost:8080', was %s", ProxyURL)
+	}
+	if TokenFile != "/run/secrets/gemnasium_token" {
+		t.Errorf("TokenFile should be '/run/secrets/gemnasium_token', was %s", TokenFile)
+	}
+}
+
+func TestWithInvalidEnvVars(t *testing.T) {
+	orgMaxRetries, orgTimeout := MaxRetries, Timeout
+	defer func() {
+		MaxRetries, Timeout = orgMaxRetries, orgTimeout
+		envErrors = nil
+	}()
+	for name, value := range map[string]string{
+		ENV_MAX_RETRIES:          "many",
+		ENV_TIMEOUT:              "1 minute",
+		ENV_INSECURE_SKIP_VERIFY: "yes",
+	} {
+		if org, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, org)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Setenv(name, value)
+	}
+
+	MaxRetries, Timeout = 3, time.Minute
+	err := loadEnv()
+	if err == nil {
+		t.Fatal("Expected errors for the invalid env vars")
+	}
+	for _, name := range []string{ENV_MAX_RETRIES, ENV_TIMEOUT, ENV_INSECURE_SKIP_VERIFY} {
+		if !strings.Contains(err.Error(), "env:"+name+": ") {
+			t.Errorf("Expected an error for %s, got %s", name, err)
+		}
+	}
+	if MaxRetries != 3 || Timeout != time.Minute {
+		t.Errorf("Invalid values should be ignored, got %d and %s", MaxRetries, Timeout)
+	}
+	// Reported by `config validate` too
+	if err := Validate(); err == nil || !strings.Contains(err.Error(), "env:"+ENV_TIMEOUT+": ") {
+		t.Errorf("Expected Validate to report the env vars, got %v", err)
+	}
 }
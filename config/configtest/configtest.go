@@ -0,0 +1,32 @@
+// Package configtest helps testing the packages calling the API, without
+// reading nor writing the settings and caches of the user.
+package configtest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// Run the tests of m with the API responses cached in a new temporary
+// directory instead of the cache of the user, and revalidated on every call,
+// so that tests don't share responses. They're set with the env vars, to be
+// kept when the config is loaded again (ex: with --profile). To be called
+// from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(configtest.Run(m))
+//	}
+func Run(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "gemnasium-cache")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(config.ENV_CACHE_DIR, dir)
+	os.Setenv(config.ENV_CACHE_TTL, "0")
+	config.CacheDir, config.CacheTTL = dir, 0
+	return m.Run()
+}
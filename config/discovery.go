@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gemnasium/toolbelt/ignore"
+)
+
+// Path of the project config file, found like git finds its repository: in
+// the current directory or else in its parents, up to the root of the git
+// repository (or up to the home directory, outside of a repository). It's
+// CONFIG_FILE_PATH in the current directory if there's none, to create it
+// there.
+var ProjectConfigFile = CONFIG_FILE_PATH
+
+// Lambda to be overriden in tests
+var userHomeDir = os.UserHomeDir
+
+// Search CONFIG_FILE_PATH in dir and its parents, up to the first one
+// holding a git repository. Outside of a repository, the search stops below
+// the home directory, not to pick a stray config file in $HOME or /tmp.
+// Return its path relative to dir, "" if not found.
+func findProjectConfigFile(dir string) string {
+	top := ignore.RepositoryRoot(dir)
+	if top == "" {
+		top = dir
+		if home, err := userHomeDir(); err == nil {
+			rel, err := filepath.Rel(home, dir)
+			if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				top = filepath.Join(home, strings.Split(rel, string(filepath.Separator))[0])
+			}
+		}
+	}
+	for current := dir; ; current = filepath.Dir(current) {
+		path := filepath.Join(current, CONFIG_FILE_PATH)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				return rel
+			}
+			return path
+		}
+		if current == top || filepath.Dir(current) == current {
+			return ""
+		}
+	}
+}
+
+// Set ProjectConfigFile and ProjectDir, the directory of the project
+func discoverProjectConfigFile() error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	ProjectConfigFile, ProjectDir = CONFIG_FILE_PATH, wd
+	if path := findProjectConfigFile(wd); path != "" {
+		ProjectConfigFile = path
+		ProjectDir = filepath.Dir(filepath.Join(wd, path))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscoverProjectConfigFile(t *testing.T) {
+	withUserConfig(t, "")
+	dir, err := ioutil.TempDir("", "gemnasium-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Resolve the symlinks, to compare with the current directory
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(dir, "repo")
+	subdir := filepath.Join(repo, "apps", "rails")
+	for _, d := range []string{filepath.Join(repo, ".git"), subdir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Outside of the repository, never read
+	if err := ioutil.WriteFile(filepath.Join(dir, CONFIG_FILE_PATH), []byte("project_slug: outside\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+
+	if err := os.Chdir(subdir); err != nil {
+		t.Fatal(err)
+	}
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if ProjectSlug != "" || ProjectConfigFile != CONFIG_FILE_PATH || ProjectDir != subdir {
+		t.Errorf("Expected no project config file above the repository, got %s (%s)", ProjectConfigFile, ProjectSlug)
+	}
+
+	data := "project_slug: repo\nca_file: certs/ca.pem\nignored_paths: [tmp/]\n"
+	if err := ioutil.WriteFile(filepath.Join(repo, CONFIG_FILE_PATH), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	expectedPath := filepath.Join("..", "..", CONFIG_FILE_PATH)
+	if ProjectSlug != "repo" || ProjectConfigFile != expectedPath || Origin("project_slug") != "file:"+expectedPath {
+		t.Errorf("Expected project_slug to be read from %s, got %q from %s", expectedPath, ProjectSlug, Origin("project_slug"))
+	}
+	if ProjectDir != repo {
+		t.Errorf("Expected project dir to be %s, got %s", repo, ProjectDir)
+	}
+	// Relative to the config file, not to the current directory
+	if expected := filepath.Join(repo, "certs", "ca.pem"); CAFile != expected {
+		t.Errorf("Expected ca_file to be %s, got %s", expected, CAFile)
+	}
+
+	// config set writes the file found
+	if err := Set("timeout", "2m", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(CONFIG_FILE_PATH); !os.IsNotExist(err) {
+		t.Errorf("Expected no config file to be created in the current directory")
+	}
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if Timeout.String() != "2m0s" {
+		t.Errorf("Expected timeout to be set in %s, got %s", expectedPath, Timeout)
+	}
+}
+
+func TestFindProjectConfigFileOutsideRepository(t *testing.T) {
+	home := t.TempDir()
+	orgUserHomeDir := userHomeDir
+	defer func() { userHomeDir = orgUserHomeDir }()
+	userHomeDir = func() (string, error) { return home, nil }
+
+	project := filepath.Join(home, "work", "project")
+	subdir := filepath.Join(project, "src")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Stray config file in the home directory, never read from below it
+	if err := ioutil.WriteFile(filepath.Join(home, CONFIG_FILE_PATH), []byte("project_slug: home\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path := findProjectConfigFile(subdir); path != "" {
+		t.Errorf("Expected no project config file, got %s", path)
+	}
+	if path := findProjectConfigFile(home); path != CONFIG_FILE_PATH {
+		t.Errorf("Expected the config file of the current directory, got %q", path)
+	}
+	// Outside of the home directory, only the current directory is searched
+	if path := findProjectConfigFile(filepath.Join(home, "..")); path != "" {
+		t.Errorf("Expected no project config file, got %s", path)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(project, CONFIG_FILE_PATH), []byte("project_slug: project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, expected := findProjectConfigFile(subdir), filepath.Join("..", CONFIG_FILE_PATH); path != expected {
+		t.Errorf("Expected %s, got %q", expected, path)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v1"
+)
+
+// Set the keys of the project config file to values, keeping its other
+// settings and its comments
+func WriteProjectSettings(values map[string]interface{}) error {
+	return updateConfigFile(ProjectConfigFile, values, 0644)
+}
+
+// Return the settings set in the project config file only
+func ProjectSettings() (*Settings, error) {
+	c, err := readConfigFile(ProjectConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	s, errs := decodeSettings(c, ProjectConfigFile, projectConfigKeys)
+	return s, errs.err()
+}
+
+// Set the top level keys of the config file at path to values, creating it
+// with perm if missing. The other keys and the comments are kept, unless
+// the file is too complex to be edited line by line.
+func updateConfigFile(path string, values map[string]interface{}, perm os.FileMode) error {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Sorted, to add the missing keys in a stable order
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	edited := dat
+	for _, key := range keys {
+		if edited, err = setYAMLKey(edited, key, values[key]); err != nil {
+			return err
+		}
+	}
+	if !sameKeys(edited, values) {
+		// Rewrite the whole file, losing the comments
+		c := map[string]interface{}{}
+		if err := yaml.Unmarshal(dat, &c); err != nil {
+			return ConfigErrors{{Path: path, Msg: err.Error()}}
+		}
+		for key, value := range values {
+			c[key] = value
+		}
+		if edited, err = yaml.Marshal(c); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, edited, perm)
+}
+
+// Check that the YAML data can be decoded, and that the keys have values
+func sameKeys(data []byte, values map[string]interface{}) bool {
+	c := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return false
+	}
+	for key, value := range values {
+		expected, _ := yaml.Marshal(value)
+		got, _ := yaml.Marshal(c[key])
+		if string(expected) != string(got) {
+			return false
+		}
+	}
+	return true
+}
+
+// Set the top level key of the YAML data to value, replacing the lines of
+// its current value or else adding it at the end. The comment at the end of
+// a single line value is kept.
+func setYAMLKey(data []byte, key string, value interface{}) ([]byte, error) {
+	rendered, err := yaml.Marshal(map[string]interface{}{key: value})
+	if err != nil {
+		return nil, err
+	}
+	newLines := strings.Split(strings.TrimSuffix(string(rendered), "\n"), "\n")
+
+	text := string(data)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, key+":") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return []byte(text + strings.Join(newLines, "\n") + "\n"), nil
+	}
+
+	// The value spans the indented lines, and the list items, that follow
+	end := start
+	for j := start + 1; j < len(lines); j++ {
+		trimmed := strings.TrimSpace(lines[j])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(lines[j], " ") && !strings.HasPrefix(lines[j], "\t") && !strings.HasPrefix(lines[j], "-") {
+			break
+		}
+		end = j
+	}
+	if end == start && len(newLines) == 1 {
+		if comment := trailingComment(lines[start]); comment != "" {
+			newLines[0] += comment
+		}
+	}
+	result := append(append(append([]string{}, lines[:start]...), newLines...), lines[end+1:]...)
+	return []byte(strings.Join(result, "\n") + "\n"), nil
+}
+
+// Return the comment at the end of line, with the spaces before it, or ""
+// if there's none or if the line is too complex to tell
+func trailingComment(line string) string {
+	i := strings.Index(line, " #")
+	if i < 0 || strings.ContainsAny(line[:i], `"'`) {
+		return ""
+	}
+	start := strings.TrimRight(line[:i], " ")
+	return line[len(start):]
+}
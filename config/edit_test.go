@@ -0,0 +1,56 @@
+package config
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestUpdateConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		values   map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "new file",
+			values:   map[string]interface{}{"project_slug": "abc", "timeout": "2m"},
+			expected: "project_slug: abc\ntimeout: 2m\n",
+		},
+		{
+			name:     "added key",
+			data:     "# Project\napi_key: secret",
+			values:   map[string]interface{}{"project_slug": "abc"},
+			expected: "# Project\napi_key: secret\nproject_slug: abc\n",
+		},
+		{
+			name:     "replaced value with its comment",
+			data:     "project_slug: old   # the slug\ntimeout: 1m\n",
+			values:   map[string]interface{}{"project_slug": "new"},
+			expected: "project_slug: new   # the slug\ntimeout: 1m\n",
+		},
+		{
+			name:     "replaced list",
+			data:     "ignored_paths:\n  - vendor/\n\n  # generated\n  - dist/\n# Timeout\ntimeout: 1m\n",
+			values:   map[string]interface{}{"ignored_paths": []string{"tmp/"}},
+			expected: "ignored_paths:\n- tmp/\n# Timeout\ntimeout: 1m\n",
+		},
+		{
+			name:     "nested key untouched",
+			data:     "profiles:\n  onprem:\n    project_slug: nested\n",
+			values:   map[string]interface{}{"project_slug": "abc"},
+			expected: "profiles:\n  onprem:\n    project_slug: nested\nproject_slug: abc\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempConfig(t, tt.data)
+			if err := updateConfigFile(path, tt.values, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if dat, _ := ioutil.ReadFile(path); string(dat) != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, dat)
+			}
+		})
+	}
+}
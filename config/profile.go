@@ -0,0 +1,265 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Profiles are named sets of settings kept in the user config file, to use
+// several Gemnasium endpoints (ex: gemnasium.com and an on-premise
+// instance) without editing the config each time:
+//
+//	current_profile: onprem
+//	profiles:
+//	  public:
+//	    api_endpoint: https://api.gemnasium.com/v1
+//	  onprem:
+//	    api_endpoint: https://gemnasium.example.com/api/v2
+//	    api_version: 2
+//	    credential_helper: pass show gemnasium/onprem
+//	    timeout: 2m
+//
+// A profile accepts the same keys as .gemnasium.yml, which overrides it.
+// It overrides the keys set at the top level of the user config file.
+var (
+	// Name of the profile in use, "" if none
+	ProfileName string
+	// Path of the user config file, "" if there's no user config dir
+	UserConfigFile = defaultUserConfigFile()
+)
+
+type Profile struct {
+	Name     string
+	Settings *Settings
+}
+
+// Return the endpoint set in the profile, or the default one
+func (p Profile) Endpoint() string {
+	if p.Settings.APIEndpoint != nil {
+		return *p.Settings.APIEndpoint
+	}
+	return DEFAULT_API_ENDPOINT
+}
+
+// Return the API version set in the profile, 0 if it's detected
+func (p Profile) APIVersion() int {
+	if p.Settings.APIVersion != nil {
+		return *p.Settings.APIVersion
+	}
+	return 0
+}
+
+func defaultUserConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gemnasium", "config.yml")
+}
+
+// Use the profile name, whatever the current profile of the user config
+// file, and load the configuration again. An empty name selects the default
+// profile again (GEMNASIUM_PROFILE or the current profile).
+func SelectProfile(name string) error {
+	reset()
+	ProfileName = name
+	return load()
+}
+
+// Make name the current profile of the user config file, used by default by
+// the next runs.
+func UseProfile(name string) error {
+	c, err := readUserConfig()
+	if err != nil {
+		return err
+	}
+	profiles, err := profiles(c)
+	if err != nil {
+		return err
+	}
+	if _, ok := findProfile(profiles, name); !ok {
+		return unknownProfileError(name, profiles)
+	}
+	return writeUserConfig(map[string]interface{}{"current_profile": name})
+}
+
+// Return the profiles of the user config file, sorted by name
+func Profiles() ([]Profile, error) {
+	c, err := readUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	return profiles(c)
+}
+
+// List the profiles of the user config file, the one in use being marked
+// with a *
+func ListProfiles() error {
+	profiles, err := Profiles()
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		fmt.Printf("No profile in %s\n", UserConfigFile)
+		return nil
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"", "Name", "Endpoint", "API version"})
+	for _, p := range profiles {
+		current := ""
+		if p.Name == ProfileName {
+			current = "*"
+		}
+		version := "detected"
+		if p.APIVersion() != 0 {
+			version = strconv.Itoa(p.APIVersion())
+		}
+		table.Append([]string{current, p.Name, p.Endpoint(), version})
+	}
+	table.Render()
+	return nil
+}
+
+// Apply the settings of the selected profile: the one set with --profile,
+// GEMNASIUM_PROFILE, or else the current profile of the user config file.
+func loadProfile() error {
+	if UserConfigFile == "" {
+		return nil
+	}
+	c, err := readUserConfig()
+	if err != nil {
+		return err
+	}
+	profiles, err := profiles(c)
+	if err != nil {
+		return err
+	}
+	name := ProfileName
+	if name == "" {
+		name = os.Getenv(ENV_PROFILE)
+	}
+	if name == "" {
+		name, _ = c["current_profile"].(string)
+	}
+	if name == "" {
+		return nil
+	}
+	p, ok := findProfile(profiles, name)
+	if !ok {
+		return unknownProfileError(name, profiles)
+	}
+	ProfileName = name
+	p.Settings.resolvePaths(filepath.Dir(UserConfigFile))
+	p.Settings.apply(fmt.Sprintf("file:%s (profile %s)", UserConfigFile, name))
+	return nil
+}
+
+func readUserConfig() (map[string]interface{}, error) {
+	return readConfigFile(UserConfigFile)
+}
+
+// Set the top level keys of the user config file to values
+func writeUserConfig(values map[string]interface{}) error {
+	if UserConfigFile == "" {
+		return errors.New("No user config dir, please set $HOME")
+	}
+	// Profiles may hold API keys
+	return updateConfigFile(UserConfigFile, values, 0600)
+}
+
+// Decode and validate the profiles of the user config file c, sorted by name
+func profiles(c map[string]interface{}) ([]Profile, error) {
+	var errs ConfigErrors
+	fail := func(msg string, keys ...string) {
+		errs = append(errs, &ConfigError{Path: UserConfigFile, Line: locateKey(UserConfigFile, keys...), Msg: msg})
+	}
+	current, ok := c["current_profile"]
+	if _, isString := current.(string); ok && !isString {
+		fail("current_profile: expected a profile name, got "+describe(current), "current_profile")
+	}
+	raw, ok := c["profiles"]
+	if !ok {
+		return nil, errs.err()
+	}
+	m, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		fail("profiles: expected a map of profile names to settings, got "+describe(raw), "profiles")
+		return nil, errs
+	}
+	var profiles []Profile
+	for name, settings := range m {
+		p := Profile{Name: fmt.Sprint(name), Settings: &Settings{}}
+		if settings != nil {
+			s, ok := settings.(map[interface{}]interface{})
+			if !ok {
+				fail(p.Name+": expected the settings of the profile, got "+describe(settings), "profiles", p.Name)
+				continue
+			}
+			sm := map[string]interface{}{}
+			for k, v := range s {
+				sm[fmt.Sprint(k)] = v
+			}
+			var settingsErrs ConfigErrors
+			p.Settings, settingsErrs = decodeSettings(sm, UserConfigFile, nil, "profiles", p.Name)
+			errs = append(errs, settingsErrs...)
+		}
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	if name, ok := current.(string); ok && name != "" {
+		if _, found := findProfile(profiles, name); !found {
+			fail("current_profile: "+unknownProfileError(name, profiles).Error(), "current_profile")
+		}
+	}
+	return profiles, errs.err()
+}
+
+func findProfile(profiles []Profile, name string) (Profile, bool) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+func unknownProfileError(name string, profiles []Profile) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("Unknown profile %s: no profile in %s", name, UserConfigFile)
+	}
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return fmt.Errorf("Unknown profile %s, available profiles: %s", name, strings.Join(names, ", "))
+}
+
+// Reset the settings read in the config files and env vars to their
+// defaults, before loading them again
+func reset() {
+	APIEndpoint = DEFAULT_API_ENDPOINT
+	APIKey = ""
+	ConfiguredAPIVersion = 0
+	ProjectSlug = ""
+	IgnoredPaths, IncludePaths = nil, nil
+	ExcludedDirs = DEFAULT_EXCLUDED_DIRS
+	MaxRetries = DEFAULT_MAX_RETRIES
+	RetryWait = DEFAULT_RETRY_WAIT
+	RetryMaxWait = DEFAULT_RETRY_MAX_WAIT
+	Timeout = DEFAULT_TIMEOUT
+	CacheDir = ""
+	CacheTTL = DEFAULT_CACHE_TTL
+	CAFile, ClientCert, ClientKey = "", "", ""
+	InsecureSkipVerify = false
+	ProxyURL = ""
+	TokenFile, CredentialHelper, CredentialStore = "", "", ""
+	Projects = nil
+}
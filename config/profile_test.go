@@ -0,0 +1,151 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const userConfigData = `
+current_profile: onprem
+profiles:
+  public:
+    api_endpoint: https://api.gemnasium.com/v1
+  onprem:
+    api_endpoint: https://gemnasium.example.com/api/v2
+    api_version: 2
+    api_key: onprem-key
+    credential_helper: pass show gemnasium/onprem
+    timeout: 2m
+    ignored_paths:
+      - vendor/
+`
+
+// Use a temp user config file holding data, and return its path
+func withUserConfig(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "gemnasium-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgFile := UserConfigFile
+	UserConfigFile = filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(UserConfigFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Env vars set by other tests would override the config files
+	for _, s := range settings {
+		if s.Env != "" {
+			os.Unsetenv(s.Env)
+		}
+	}
+	os.Unsetenv(ENV_PROFILE)
+	t.Cleanup(func() {
+		UserConfigFile = orgFile
+		os.RemoveAll(dir)
+		SelectProfile("")
+	})
+	return UserConfigFile
+}
+
+func TestSelectProfile(t *testing.T) {
+	path := withUserConfig(t, userConfigData)
+
+	// The current profile is used by default
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if ProfileName != "onprem" {
+		t.Errorf("ProfileName should be 'onprem', was %s", ProfileName)
+	}
+	if APIEndpoint != "https://gemnasium.example.com/api/v2" || ConfiguredAPIVersion != 2 {
+		t.Errorf("Unexpected APIEndpoint and ConfiguredAPIVersion: %s, %d", APIEndpoint, ConfiguredAPIVersion)
+	}
+	if APIKey != "onprem-key" || Origin("api_key") != "file:"+path+" (profile onprem)" {
+		t.Errorf("Unexpected APIKey and origin: %s, %s", APIKey, Origin("api_key"))
+	}
+	if CredentialHelper != "pass show gemnasium/onprem" {
+		t.Errorf("CredentialHelper should be 'pass show gemnasium/onprem', was %s", CredentialHelper)
+	}
+	if Timeout != 2*time.Minute {
+		t.Errorf("Timeout should be 2m, was %s", Timeout)
+	}
+	if !reflect.DeepEqual(IgnoredPaths, []string{"vendor/"}) {
+		t.Errorf("IgnoredPaths should be [vendor/], was %v", IgnoredPaths)
+	}
+
+	// Selecting another profile drops the settings of the previous one
+	if err := SelectProfile("public"); err != nil {
+		t.Fatal(err)
+	}
+	if APIEndpoint != "https://api.gemnasium.com/v1" || ConfiguredAPIVersion != 0 {
+		t.Errorf("Unexpected APIEndpoint and ConfiguredAPIVersion: %s, %d", APIEndpoint, ConfiguredAPIVersion)
+	}
+	if APIKey != "" || CredentialHelper != "" || Timeout != DEFAULT_TIMEOUT || IgnoredPaths != nil {
+		t.Errorf("Settings of profile onprem should have been dropped")
+	}
+
+	// GEMNASIUM_PROFILE overrides the current profile
+	os.Setenv(ENV_PROFILE, "public")
+	defer os.Unsetenv(ENV_PROFILE)
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if ProfileName != "public" {
+		t.Errorf("ProfileName should be 'public', was %s", ProfileName)
+	}
+
+	err := SelectProfile("staging")
+	if err == nil || !strings.Contains(err.Error(), "available profiles: onprem, public") {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+}
+
+func TestProfileOverriddenByConfigFile(t *testing.T) {
+	withUserConfig(t, userConfigData)
+	if err := ioutil.WriteFile(CONFIG_FILE_PATH, []byte("api_key: project-key\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(CONFIG_FILE_PATH)
+
+	if err := SelectProfile("onprem"); err != nil {
+		t.Fatal(err)
+	}
+	if APIKey != "project-key" || Origin("api_key") != "file:"+CONFIG_FILE_PATH {
+		t.Errorf("Unexpected APIKey and origin: %s, %s", APIKey, Origin("api_key"))
+	}
+	if APIEndpoint != "https://gemnasium.example.com/api/v2" {
+		t.Errorf("APIEndpoint should come from the profile, was %s", APIEndpoint)
+	}
+}
+
+func TestUseProfile(t *testing.T) {
+	path := withUserConfig(t, userConfigData)
+
+	if err := UseProfile("public"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if ProfileName != "public" {
+		t.Errorf("ProfileName should be 'public', was %s", ProfileName)
+	}
+	profiles, err := Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].Name != "onprem" || profiles[0].Endpoint() != "https://gemnasium.example.com/api/v2" || profiles[1].Name != "public" {
+		t.Errorf("Unexpected profiles: %v", profiles)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("The user config file should be private: %v, %v", info.Mode(), err)
+	}
+
+	if err := UseProfile("staging"); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
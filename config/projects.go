@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A monorepo holds several Gemnasium projects, each one mapped to a
+// subdirectory in the projects section of .gemnasium.yml:
+//
+//	projects:
+//	  apps/rails:
+//	    project_slug: 2f4c6e8a
+//	    ignored_paths:
+//	      - tmp/
+//	  services/api:
+//	    project_slug: 9b1d3f5e
+//
+// The project_slug set at the top level, if any, is the project of the
+// files that don't belong to any subdirectory.
+var (
+	// Projects of the projects section, sorted by path
+	Projects []SubProject
+	// Directory of the project config file, where the paths of Projects
+	// and ignored_paths start. The current directory if there's none.
+	ProjectDir string
+)
+
+// A project mapped to a subdirectory of the repository
+type SubProject struct {
+	Path         string // Relative to ProjectDir, with slashes
+	Slug         string
+	IgnoredPaths []string // Added to the global ignored_paths
+}
+
+// Keys of a project in the projects section
+var subProjectKeys = []string{"project_slug", "ignored_paths"}
+
+// Decode and validate the projects section of the project config file at
+// path, sorted by path
+func decodeProjects(raw interface{}, path string) ([]SubProject, ConfigErrors) {
+	var errs ConfigErrors
+	fail := func(msg string, keys ...string) {
+		errs = append(errs, &ConfigError{Path: path, Line: locateKey(path, keys...), Msg: msg})
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	m, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		fail("projects: expected a map of paths to projects, got "+describe(raw), "projects")
+		return nil, errs
+	}
+	var projects []SubProject
+	for key, value := range m {
+		name := fmt.Sprint(key)
+		p := SubProject{Path: filepath.ToSlash(filepath.Clean(name))}
+		if filepath.IsAbs(name) || p.Path == "." || p.Path == ".." || strings.HasPrefix(p.Path, "../") {
+			fail(name+": expected a subdirectory of the repository", "projects", name)
+			continue
+		}
+		settings, ok := value.(map[interface{}]interface{})
+		if !ok {
+			fail(name+": expected the project_slug of the project, got "+describe(value), "projects", name)
+			continue
+		}
+		valid := true
+		for k, v := range settings {
+			k := fmt.Sprint(k)
+			var err error
+			switch k {
+			case "project_slug":
+				var slug interface{}
+				if slug, err = decodeValue(reflect.TypeOf(""), v); err == nil {
+					p.Slug = slug.(string)
+				}
+			case "ignored_paths":
+				var paths interface{}
+				if paths, err = decodeValue(reflect.TypeOf([]string{}), v); err == nil {
+					p.IgnoredPaths = paths.([]string)
+				}
+			default:
+				err = fmt.Errorf("unknown key%s", suggest(k, subProjectKeys))
+			}
+			if err != nil {
+				fail(fmt.Sprintf("%s: %s: %s", name, k, err), "projects", name, k)
+				valid = false
+			}
+		}
+		if valid && p.Slug == "" {
+			fail(name+": project_slug is missing", "projects", name)
+			valid = false
+		}
+		if valid {
+			projects = append(projects, p)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Path < projects[j].Path })
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	return projects, errs
+}
+
+// Read the project config file, with its projects section
+func loadConfig() error {
+	if err := discoverProjectConfigFile(); err != nil {
+		return err
+	}
+	c, err := readConfigFile(ProjectConfigFile)
+	if err != nil {
+		return err
+	}
+	s, errs := decodeSettings(c, ProjectConfigFile, projectConfigKeys)
+	projects, projectErrs := decodeProjects(c["projects"], ProjectConfigFile)
+	if errs = append(errs, projectErrs...); len(errs) > 0 {
+		return errs
+	}
+	s.resolvePaths(ProjectDir)
+	s.apply("file:" + ProjectConfigFile)
+	Projects = projects
+	return nil
+}
+
+// Return the project of the current directory: the innermost project of
+// Projects containing it, or nil if it's outside of them.
+func CurrentSubProject() (*SubProject, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return subProjectOf(wd), nil
+}
+
+// Return the innermost project of Projects containing dir, nil if none
+func subProjectOf(dir string) *SubProject {
+	rel, err := filepath.Rel(ProjectDir, dir)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	var found *SubProject
+	for i, p := range Projects {
+		if rel == p.Path || strings.HasPrefix(rel, p.Path+"/") {
+			// Sorted by path, so nested projects come after their parent
+			found = &Projects[i]
+		}
+	}
+	return found
+}
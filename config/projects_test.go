@@ -0,0 +1,84 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateProjects(t *testing.T) {
+	path := writeTempConfig(t, `projects:
+  apps/rails/:
+    project_slug: rails-slug
+    ignored_paths:
+      - tmp/
+  services/api:
+    project_slg: api-slug
+  ../worker:
+    project_slug: worker-slug
+  services/front:
+    ignored_paths: [dist/]
+`)
+	err := Validate(path)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	expected := []string{
+		path + ":7: services/api: project_slg: unknown key, did you mean project_slug?",
+		path + ":8: ../worker: expected a subdirectory of the repository",
+		path + ":10: services/front: project_slug is missing",
+	}
+	if err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), err)
+	}
+}
+
+func TestDecodeProjects(t *testing.T) {
+	raw := map[interface{}]interface{}{
+		"services/api/": map[interface{}]interface{}{"project_slug": "api-slug"},
+		"apps/rails": map[interface{}]interface{}{
+			"project_slug":  123,
+			"ignored_paths": []interface{}{"tmp/"},
+		},
+	}
+	projects, errs := decodeProjects(raw, CONFIG_FILE_PATH)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	expected := []SubProject{
+		{Path: "apps/rails", Slug: "123", IgnoredPaths: []string{"tmp/"}},
+		{Path: "services/api", Slug: "api-slug"},
+	}
+	if !reflect.DeepEqual(projects, expected) {
+		t.Errorf("Expected projects %v, got %v", expected, projects)
+	}
+}
+
+func TestSubProjectOf(t *testing.T) {
+	oldDir := ProjectDir
+	ProjectDir = filepath.FromSlash("/src/repo")
+	Projects = []SubProject{{Path: "apps", Slug: "apps"}, {Path: "apps/rails", Slug: "rails"}}
+	defer func() { ProjectDir, Projects = oldDir, nil }()
+
+	var tests = []struct {
+		Dir  string
+		Slug string
+	}{
+		{"/src/repo", ""},
+		{"/src/repo/lib", ""},
+		{"/src/repo/apps", "apps"},
+		{"/src/repo/apps/node", "apps"},
+		{"/src/repo/apps/rails/config", "rails"},
+		{"/src/repo/apps/railsy", "apps"},
+	}
+	for _, test := range tests {
+		slug := ""
+		if p := subProjectOf(filepath.FromSlash(test.Dir)); p != nil {
+			slug = p.Slug
+		}
+		if slug != test.Slug {
+			t.Errorf("Expected project of %s to be %q, got %q", test.Dir, test.Slug, slug)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings of a config file or profile. Nil fields aren't set, and leave
+// the value of the previous layers unchanged.
+type Settings struct {
+	APIEndpoint        *string        `yaml:"api_endpoint"`
+	APIVersion         *int           `yaml:"api_version"`
+	APIKey             *string        `yaml:"api_key"`
+	ProjectSlug        *string        `yaml:"project_slug"`
+	IgnoredPaths       *[]string      `yaml:"ignored_paths"`
+	IncludePaths       *[]string      `yaml:"include_paths"`
+	ExcludedDirs       *[]string      `yaml:"excluded_dirs"`
+	MaxRetries         *int           `yaml:"max_retries"`
+	RetryWait          *time.Duration `yaml:"retry_wait"`
+	RetryMaxWait       *time.Duration `yaml:"retry_max_wait"`
+	Timeout            *time.Duration `yaml:"timeout"`
+	CacheDir           *string        `yaml:"cache_dir"`
+	CacheTTL           *time.Duration `yaml:"cache_ttl"`
+	CAFile             *string        `yaml:"ca_file"`
+	ClientCert         *string        `yaml:"client_cert"`
+	ClientKey          *string        `yaml:"client_key"`
+	InsecureSkipVerify *bool          `yaml:"insecure_skip_verify"`
+	ProxyURL           *string        `yaml:"proxy_url"`
+	TokenFile          *string        `yaml:"token_file"`
+	CredentialHelper   *string        `yaml:"credential_helper"`
+	CredentialStore    *string        `yaml:"credential_store"`
+}
+
+// Keys of .gemnasium.yml written by older versions, and not used anymore
+var obsoleteKeys = []string{"project_name", "project_branch"}
+
+// Keys of the project config file besides the settings
+var projectConfigKeys = append([]string{"projects"}, obsoleteKeys...)
+
+// Keys of the user config file only
+var userConfigKeys = []string{"current_profile", "profiles"}
+
+// An error in a config file. Line is 0 if the key couldn't be located.
+type ConfigError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// All the errors found in config files, one per line
+type ConfigErrors []*ConfigError
+
+func (errs ConfigErrors) Error() string {
+	var lines []string
+	for _, e := range errs {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Return errs as an error, nil if empty
+func (errs ConfigErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Decode and validate the settings read in the config file at path. The
+// settings are nested under parents in the file (ex: profiles, onprem), and
+// extraKeys are allowed besides the settings.
+func decodeSettings(c map[string]interface{}, path string, extraKeys []string, parents ...string) (*Settings, ConfigErrors) {
+	s := &Settings{}
+	var errs ConfigErrors
+	fail := func(key, format string, args ...interface{}) {
+		keys := append(append([]string{}, parents...), key)
+		errs = append(errs, &ConfigError{Path: path, Line: locateKey(path, keys...), Msg: key + ": " + fmt.Sprintf(format, args...)})
+	}
+
+	// Sorted, to report the errors in a stable order
+	var keys []string
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	v := reflect.ValueOf(s).Elem()
+	for _, key := range keys {
+		field, ok := settingField(v, key)
+		if !ok {
+			if !contains(extraKeys, key) {
+				fail(key, "unknown key%s", suggest(key, append(settingKeys(), extraKeys...)))
+			}
+			continue
+		}
+		value, err := decodeValue(field.Type().Elem(), c[key])
+		if err != nil {
+			fail(key, "%s", err)
+			continue
+		}
+		if err := validateValue(key, value); err != nil {
+			fail(key, "%s", err)
+			continue
+		}
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(reflect.ValueOf(value))
+		field.Set(ptr)
+	}
+	return s, errs
+}
+
+// Return the field of the Settings v for key
+func settingField(v reflect.Value, key string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("yaml") == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// Return the keys of all the settings
+func settingKeys() []string {
+	t := reflect.TypeOf(Settings{})
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, t.Field(i).Tag.Get("yaml"))
+	}
+	return keys
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Convert the value decoded from YAML to type t
+func decodeValue(t reflect.Type, value interface{}) (interface{}, error) {
+	switch {
+	case t == durationType:
+		switch v := value.(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected a duration (ex: 30s, 2m), got %q", v)
+			}
+			return d, nil
+		case int:
+			// Durations of 0 don't need a unit
+			if v == 0 {
+				return time.Duration(0), nil
+			}
+		}
+		return nil, fmt.Errorf("expected a duration (ex: 30s, 2m), got %v", value)
+	case t.Kind() == reflect.String:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int:
+			// Unquoted slugs and keys may be numbers
+			return strconv.Itoa(v), nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", describe(value))
+	case t.Kind() == reflect.Int:
+		if v, ok := value.(int); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected an integer, got %v", describe(value))
+	case t.Kind() == reflect.Bool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected true or false, got %v", describe(value))
+	case t.Kind() == reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list, got %v", describe(value))
+		}
+		list := []string{}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of strings, got %v", describe(item))
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// Describe a value decoded from YAML, for error messages
+func describe(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nothing"
+	case []interface{}:
+		return "a list"
+	case map[interface{}]interface{}:
+		return "a map"
+	case string:
+		return fmt.Sprintf("%q", value)
+	}
+	return fmt.Sprint(value)
+}
+
+// Check the values which type isn't enough to be valid
+func validateValue(key string, value interface{}) error {
+	switch key {
+	case "api_version":
+		if v := value.(int); v != 1 && v != 2 {
+			return fmt.Errorf("expected 1 or 2, got %d", v)
+		}
+	case "max_retries":
+		if value.(int) < 0 {
+			return errors.New("can't be negative")
+		}
+	case "retry_wait", "retry_max_wait", "timeout", "cache_ttl":
+		if value.(time.Duration) < 0 {
+			return errors.New("can't be negative")
+		}
+	case "api_endpoint", "proxy_url":
+		u, err := url.Parse(value.(string))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("expected an URL (ex: https://gemnasium.example.com/api/v2), got %q", value)
+		}
+	case "credential_store":
+		// Stores of the auth package
+		if v := value.(string); v != "" && v != "netrc" && v != "encrypted" {
+			return fmt.Errorf("expected netrc or encrypted, got %q", v)
+		}
+	}
+	return nil
+}
+
+// Return the keys of the settings that are set
+func (s *Settings) keys() []string {
+	v := reflect.ValueOf(s).Elem()
+	var keys []string
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Field(i).IsNil() {
+			keys = append(keys, v.Type().Field(i).Tag.Get("yaml"))
+		}
+	}
+	return keys
+}
+
+// Make the relative paths of the settings relative to dir, the directory of
+// their config file, instead of the current directory
+func (s *Settings) resolvePaths(dir string) {
+	for _, path := range []*string{s.CacheDir, s.CAFile, s.ClientCert, s.ClientKey, s.TokenFile} {
+		if path != nil && *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+}
+
+// Set the config vars to the settings that are set. origin tells where the
+// settings come from, see Origin.
+func (s *Settings) apply(origin string) {
+	for _, key := range s.keys() {
+		origins[key] = origin
+	}
+	if s.APIEndpoint != nil {
+		APIEndpoint = *s.APIEndpoint
+	}
+	if s.APIVersion != nil {
+		ConfiguredAPIVersion = *s.APIVersion
+	}
+	if s.APIKey != nil {
+		APIKey = *s.APIKey
+	}
+	if s.ProjectSlug != nil {
+		ProjectSlug = *s.ProjectSlug
+	}
+	if s.IgnoredPaths != nil {
+		IgnoredPaths = *s.IgnoredPaths
+	}
+	if s.IncludePaths != nil {
+		IncludePaths = *s.IncludePaths
+	}
+	if s.ExcludedDirs != nil {
+		ExcludedDirs = *s.ExcludedDirs
+	}
+	if s.MaxRetries != nil {
+		MaxRetries = *s.MaxRetries
+	}
+	if s.RetryWait != nil {
+		RetryWait = *s.RetryWait
+	}
+	if s.RetryMaxWait != nil {
+		RetryMaxWait = *s.RetryMaxWait
+	}
+	if s.Timeout != nil {
+		Timeout = *s.Timeout
+	}
+	if s.CacheDir != nil {
+		CacheDir = *s.CacheDir
+	}
+	if s.CacheTTL != nil {
+		CacheTTL = *s.CacheTTL
+	}
+	if s.CAFile != nil {
+		CAFile = *s.CAFile
+	}
+	if s.ClientCert != nil {
+		ClientCert = *s.ClientCert
+	}
+	if s.ClientKey != nil {
+		ClientKey = *s.ClientKey
+	}
+	if s.InsecureSkipVerify != nil {
+		InsecureSkipVerify = *s.InsecureSkipVerify
+	}
+	if s.ProxyURL != nil {
+		ProxyURL = *s.ProxyURL
+	}
+	if s.TokenFile != nil {
+		TokenFile = *s.TokenFile
+	}
+	if s.CredentialHelper != nil {
+		CredentialHelper = *s.CredentialHelper
+	}
+	if s.CredentialStore != nil {
+		CredentialStore = *s.CredentialStore
+	}
+}
+
+// Check the config files at paths, as project config files, and return all
+// the errors found. Without paths, the system, user and project config files
+// and the env vars are checked. Missing files are ignored.
+func Validate(paths ...string) error {
+	var errs ConfigErrors
+	check := func(path string, extraKeys []string) map[string]interface{} {
+		c, err := readConfigFile(path)
+		if configErrs, ok := err.(ConfigErrors); ok {
+			errs = append(errs, configErrs...)
+			return nil
+		} else if err != nil {
+			errs = append(errs, &ConfigError{Path: path, Msg: err.Error()})
+			return nil
+		}
+		_, decodeErrs := decodeSettings(c, path, extraKeys)
+		errs = append(errs, decodeErrs...)
+		return c
+	}
+	checkProject := func(path string) {
+		if c := check(path, projectConfigKeys); c != nil {
+			_, projectErrs := decodeProjects(c["projects"], path)
+			errs = append(errs, projectErrs...)
+		}
+	}
+	if len(paths) > 0 {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil {
+				errs = append(errs, &ConfigError{Path: path, Msg: "no such file"})
+				continue
+			}
+			checkProject(path)
+		}
+		return errs.err()
+	}
+	check(SystemConfigFile, nil)
+	if c := check(UserConfigFile, userConfigKeys); c != nil {
+		if _, err := profiles(c); err != nil {
+			errs = append(errs, err.(ConfigErrors)...)
+		}
+	}
+	checkProject(ProjectConfigFile)
+	errs = append(errs, envErrors...)
+	return errs.err()
+}
+
+// Return the line (starting at 1) of the key nested under the keys before
+// it in the YAML file at path, or 0 if not found. The first key is a top
+// level key, and each other key a direct child of the previous one. Only
+// block mappings are supported, which is what config files use.
+func locateKey(path string, keys ...string) int {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	parentIndent, childIndent := -1, 0
+	depth := 0
+	for i, line := range strings.Split(string(dat), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent <= parentIndent {
+			// Out of the parent mapping
+			return 0
+		}
+		if childIndent < 0 {
+			childIndent = indent
+		}
+		if indent != childIndent {
+			// Nested deeper
+			continue
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon < 0 {
+			continue
+		}
+		if strings.Trim(trimmed[:colon], `"' `) != keys[depth] {
+			continue
+		}
+		if depth == len(keys)-1 {
+			return i + 1
+		}
+		parentIndent, childIndent = indent, -1
+		depth++
+	}
+	return 0
+}
+
+// Return a hint with the candidate closest to key, if close enough
+func suggest(key string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, c := range candidates {
+		if d := levenshtein(key, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// Number of single char edits to turn a into b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
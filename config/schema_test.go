@@ -0,0 +1,153 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write data in a temp config file, and return its path
+func writeTempConfig(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "gemnasium-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "gemnasium.yml")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	path := writeTempConfig(t, `# Settings of the project
+project_slug: 123456
+timout: 30s
+ignored_paths: vendor/
+insecure_skip_verify: "yes"
+max_retries: -1
+api_version: 3
+api_endpoint: gemnasium.example.com
+retry_wait: 1 second
+cache_ttl: 0
+credential_store: keychain
+`)
+	err := Validate(path)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	expected := []string{
+		path + ":8: api_endpoint: expected an URL (ex: https://gemnasium.example.com/api/v2), got \"gemnasium.example.com\"",
+		path + ":7: api_version: expected 1 or 2, got 3",
+		path + ":11: credential_store: expected netrc or encrypted, got \"keychain\"",
+		path + ":4: ignored_paths: expected a list, got \"vendor/\"",
+		path + ":5: insecure_skip_verify: expected true or false, got \"yes\"",
+		path + ":6: max_retries: can't be negative",
+		path + ":9: retry_wait: expected a duration (ex: 30s, 2m), got \"1 second\"",
+		path + ":3: timout: unknown key, did you mean timeout?",
+	}
+	if got := strings.Split(err.Error(), "\n"); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), err)
+	}
+
+	if err := Validate(writeTempConfig(t, "ignored_paths: [vendor/\n")); err == nil || !strings.Contains(err.Error(), "gemnasium.yml: ") {
+		t.Errorf("Expected a YAML error, got %v", err)
+	}
+	if err := Validate("gemnasium.yml.example"); err != nil {
+		t.Errorf("The example config file should be valid: %s", err)
+	}
+}
+
+func TestDecodeSettings(t *testing.T) {
+	c := map[string]interface{}{
+		"project_slug":   123456,
+		"cache_ttl":      0,
+		"timeout":        "2m",
+		"ignored_paths":  []interface{}{"vendor/"},
+		"project_branch": "master",
+	}
+	s, errs := decodeSettings(c, CONFIG_FILE_PATH, obsoleteKeys)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if *s.ProjectSlug != "123456" || *s.CacheTTL != 0 || *s.Timeout != 2*time.Minute || len(*s.IgnoredPaths) != 1 {
+		t.Errorf("Unexpected settings: %v", s)
+	}
+	if s.APIEndpoint != nil {
+		t.Error("APIEndpoint should not be set")
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	withUserConfig(t, `current_profile: staging
+profiles:
+  public:
+    api_endpoint: https://api.gemnasium.com/v1
+  onprem:
+    api_version: 2
+    timeout: soon
+`)
+	err := Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, expected := range []string{
+		UserConfigFile + ":7: timeout: expected a duration (ex: 30s, 2m), got \"soon\"",
+		UserConfigFile + ":1: current_profile: Unknown profile staging, available profiles: onprem, public",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected errors to contain %q, got:\n%s", expected, err)
+		}
+	}
+
+	// Invalid config files are reported instead of panicking
+	if err := SelectProfile("onprem"); err == nil {
+		t.Error("Expected an error loading the profile")
+	}
+}
+
+func TestLocateKey(t *testing.T) {
+	path := writeTempConfig(t, `projects:
+  - path: api
+    timeout: 1m
+    onprem:
+      timeout: 2m
+profiles:
+  ci:
+    onprem:
+      timeout: 3m
+    timeout: 4m
+timeout: forever
+`)
+	tests := []struct {
+		keys []string
+		line int
+	}{
+		{[]string{"timeout"}, 11},
+		{[]string{"profiles", "ci", "timeout"}, 10},
+		{[]string{"profiles", "ci", "onprem", "timeout"}, 9},
+		{[]string{"ci"}, 0},
+		{[]string{"profiles", "timeout"}, 0},
+	}
+	for _, tt := range tests {
+		if line := locateKey(path, tt.keys...); line != tt.line {
+			t.Errorf("%v: expected line %d, got %d", tt.keys, tt.line, line)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	for key, expected := range map[string]string{
+		"api_edpoint": ", did you mean api_endpoint?",
+		"proxy":       "",
+		"colour":      "",
+	} {
+		if got := suggest(key, settingKeys()); got != expected {
+			t.Errorf("Expected suggestion for %s to be %q, got %q", key, expected, got)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v1"
+)
+
+// The configuration is made of layers, each one overriding the previous
+// ones: the system config file, the user config file, the profile in use,
+// the project config file (.gemnasium.yml), the env vars and the command
+// line flags.
+var (
+	// Path of the system config file
+	SystemConfigFile = defaultSystemConfigFile()
+)
+
+// A setting of the config files
+type setting struct {
+	Key    string
+	Env    string // Env var overriding it, if any
+	Secret bool   // Masked by `config list`
+	get    func() string
+}
+
+var settings = []setting{
+	{Key: "api_endpoint", Env: ENV_API_ENDDPOINT, get: func() string { return APIEndpoint }},
+	{Key: "api_version", get: func() string {
+		// Detected by the commands calling the API
+		if APIVersion == 0 {
+			return "auto"
+		}
+		return strconv.Itoa(APIVersion)
+	}},
+	{Key: "api_key", Env: ENV_TOKEN, Secret: true, get: func() string { return APIKey }},
+	{Key: "project_slug", Env: ENV_PROJECT_SLUG, get: func() string { return ProjectSlug }},
+	{Key: "ignored_paths", Env: ENV_IGNORED_PATHS, get: func() string { return strings.Join(IgnoredPaths, ",") }},
+	{Key: "include_paths", Env: ENV_INCLUDE_PATHS, get: func() string { return strings.Join(IncludePaths, ",") }},
+	{Key: "excluded_dirs", Env: ENV_EXCLUDED_DIRS, get: func() string { return strings.Join(ExcludedDirs, ",") }},
+	{Key: "max_retries", Env: ENV_MAX_RETRIES, get: func() string { return strconv.Itoa(MaxRetries) }},
+	{Key: "retry_wait", Env: ENV_RETRY_WAIT, get: func() string { return RetryWait.String() }},
+	{Key: "retry_max_wait", Env: ENV_RETRY_MAX_WAIT, get: func() string { return RetryMaxWait.String() }},
+	{Key: "timeout", Env: ENV_TIMEOUT, get: func() string { return Timeout.String() }},
+	{Key: "cache_dir", Env: ENV_CACHE_DIR, get: func() string { return CacheDir }},
+	{Key: "cache_ttl", Env: ENV_CACHE_TTL, get: func() string { return CacheTTL.String() }},
+	{Key: "ca_file", Env: ENV_CA_FILE, get: func() string { return CAFile }},
+	{Key: "client_cert", Env: ENV_CLIENT_CERT, get: func() string { return ClientCert }},
+	{Key: "client_key", Env: ENV_CLIENT_KEY, get: func() string { return ClientKey }},
+	{Key: "insecure_skip_verify", Env: ENV_INSECURE_SKIP_VERIFY, get: func() string { return strconv.FormatBool(InsecureSkipVerify) }},
+	{Key: "proxy_url", Env: ENV_PROXY_URL, get: func() string { return ProxyURL }},
+	{Key: "token_file", Env: ENV_TOKEN_FILE, get: func() string { return TokenFile }},
+	{Key: "credential_helper", Env: ENV_CREDENTIAL_HELPER, get: func() string { return CredentialHelper }},
+	{Key: "credential_store", Env: ENV_CREDENTIAL_STORE, get: func() string { return CredentialStore }},
+}
+
+// Layer each setting comes from, like git: "file:<path>", "env:<var>" or
+// "flag:<name>". Settings missing here have their default value.
+var origins = map[string]string{}
+
+func defaultSystemConfigFile() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "gemnasium", "config.yml")
+	}
+	return "/etc/gemnasium/config.yml"
+}
+
+func findSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// Return the layer setting key comes from, "default" if none
+func Origin(key string) string {
+	if origin, ok := origins[key]; ok {
+		return origin
+	}
+	return "default"
+}
+
+// Record that the value of key has been set by layer origin (ex: a command
+// line flag)
+func SetOrigin(key, origin string) {
+	origins[key] = origin
+}
+
+// Record the settings overridden by env vars
+func loadEnvOrigins() {
+	for _, s := range settings {
+		if s.Env != "" && os.Getenv(s.Env) != "" {
+			origins[s.Key] = "env:" + s.Env
+		}
+	}
+}
+
+// Return the effective value of key
+func Get(key string) (string, error) {
+	s, ok := findSetting(key)
+	if !ok {
+		return "", fmt.Errorf("Unknown setting: %s%s", key, suggest(key, settingKeys()))
+	}
+	return s.get(), nil
+}
+
+// Print the effective value of all the settings, as key=value lines, with
+// the layer they come from if showOrigin is true. Secrets are masked.
+func List(w io.Writer, showOrigin bool) {
+	for _, s := range settings {
+		value := s.get()
+		if s.Secret && value != "" {
+			value = "****"
+		}
+		if showOrigin {
+			fmt.Fprintf(w, "%s\t", Origin(s.Key))
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.Key, value)
+	}
+}
+
+// Set key to value in the project config file (the one found in the current
+// directory or its parents), or in the user config file
+// if global is true
+func Set(key, value string, global bool) error {
+	if _, ok := findSetting(key); !ok {
+		return fmt.Errorf("Unknown setting: %s%s", key, suggest(key, settingKeys()))
+	}
+	v, err := parseValue(key, value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	if global {
+		return writeUserConfig(map[string]interface{}{key: v})
+	}
+	return WriteProjectSettings(map[string]interface{}{key: v})
+}
+
+// Parse the value of key given on the command line to the type expected in
+// config files, and validate it
+func parseValue(key, value string) (interface{}, error) {
+	field, _ := settingField(reflect.ValueOf(&Settings{}).Elem(), key)
+	var v interface{} = value
+	switch t := field.Type().Elem(); {
+	case t == durationType:
+		// Kept as a string in config files
+	case t.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %q", value)
+		}
+		v = n
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false, got %q", value)
+		}
+		v = b
+	case t.Kind() == reflect.Slice:
+		items := []interface{}{}
+		if value != "" {
+			for _, item := range strings.Split(value, ",") {
+				items = append(items, item)
+			}
+		}
+		v = items
+	}
+	decoded, err := decodeValue(field.Type().Elem(), v)
+	if err != nil {
+		return nil, err
+	}
+	return v, validateValue(key, decoded)
+}
+
+// Read the config file at path, a missing file being an empty config
+func readConfigFile(path string) (map[string]interface{}, error) {
+	c := make(map[string]interface{})
+	if path == "" {
+		return c, nil
+	}
+	dat, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(dat, &c); err != nil {
+		return nil, ConfigErrors{{Path: path, Msg: err.Error()}}
+	}
+	return c, nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLayers(t *testing.T) {
+	userFile := withUserConfig(t, `
+timeout: 2m
+cache_ttl: 1m
+current_profile: onprem
+profiles:
+  onprem:
+    cache_ttl: 10m
+    max_retries: 1
+`)
+	dir := filepath.Dir(userFile)
+	orgSystemFile := SystemConfigFile
+	SystemConfigFile = filepath.Join(dir, "system.yml")
+	defer func() { SystemConfigFile = orgSystemFile }()
+	if err := ioutil.WriteFile(SystemConfigFile, []byte("timeout: 30s\nmax_retries: 5\nproxy_url: http://proxy:3128\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(CONFIG_FILE_PATH, []byte("max_retries: 2\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(CONFIG_FILE_PATH)
+	os.Setenv(ENV_RETRY_WAIT, "3s")
+	defer os.Unsetenv(ENV_RETRY_WAIT)
+
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key, value, origin string
+	}{
+		{"proxy_url", "http://proxy:3128", "file:" + SystemConfigFile},
+		{"timeout", "2m0s", "file:" + userFile},
+		{"cache_ttl", "10m0s", "file:" + userFile + " (profile onprem)"},
+		{"max_retries", "2", "file:" + CONFIG_FILE_PATH},
+		{"retry_wait", "3s", "env:" + ENV_RETRY_WAIT},
+		{"retry_max_wait", "30s", "default"},
+	} {
+		value, err := Get(tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != tc.value || Origin(tc.key) != tc.origin {
+			t.Errorf("Expected %s to be %s from %s, got %s from %s", tc.key, tc.value, tc.origin, value, Origin(tc.key))
+		}
+	}
+
+	var buf bytes.Buffer
+	List(&buf, true)
+	for _, expected := range []string{"file:" + CONFIG_FILE_PATH + "\tmax_retries=2\n", "default\tapi_key=\n"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected list to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+
+	if _, err := Get("colour"); err == nil {
+		t.Error("Expected an error for an unknown setting")
+	}
+}
+
+func TestListMasksSecrets(t *testing.T) {
+	orgKey := APIKey
+	APIKey = "secret-api-key"
+	defer func() { APIKey = orgKey }()
+	var buf bytes.Buffer
+	List(&buf, false)
+	if strings.Contains(buf.String(), "secret-api-key") || !strings.Contains(buf.String(), "api_key=****\n") {
+		t.Errorf("Expected api_key to be masked, got:\n%s", buf.String())
+	}
+}
+
+func TestSet(t *testing.T) {
+	userFile := withUserConfig(t, "current_profile: onprem\nprofiles:\n  onprem:\n    timeout: 1m\n")
+	defer os.Remove(CONFIG_FILE_PATH)
+
+	for _, tc := range []struct {
+		key, value string
+		global     bool
+	}{
+		{"project_slug", "my-project", false},
+		{"ignored_paths", "vendor/,tmp/", false},
+		{"insecure_skip_verify", "true", false},
+		{"cache_ttl", "30m", true},
+	} {
+		if err := Set(tc.key, tc.value, tc.global); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Profiles are kept
+	if err := SelectProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if ProjectSlug != "my-project" || len(IgnoredPaths) != 2 || !InsecureSkipVerify {
+		t.Errorf("Unexpected settings: %s, %v, %v", ProjectSlug, IgnoredPaths, InsecureSkipVerify)
+	}
+	if CacheTTL != 30*time.Minute || Origin("cache_ttl") != "file:"+userFile {
+		t.Errorf("Unexpected cache_ttl: %s from %s", CacheTTL, Origin("cache_ttl"))
+	}
+	if Timeout != time.Minute {
+		t.Errorf("Timeout should still come from the profile, was %s", Timeout)
+	}
+
+	for _, tc := range []struct{ key, value string }{
+		{"timeout", "soon"},
+		{"max_retries", "many"},
+		{"colour", "blue"},
+	} {
+		if err := Set(tc.key, tc.value, false); err == nil {
+			t.Errorf("Expected an error setting %s to %s", tc.key, tc.value)
+		}
+	}
+}
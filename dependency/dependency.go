@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"io"
 	"os"
 	"sort"
@@ -13,8 +14,8 @@ import (
 )
 
 // http://docs.gemnasium.apiary.io/#dependencies
-func ListDependencies(p *api.Project) error {
-	deps, err := project.ProjectDependencies(p)
+func ListDependencies(ctx context.Context, p *api.Project) error {
+	deps, err := project.ProjectDependencies(ctx, p)
 	if err != nil {
 		return err
 	}
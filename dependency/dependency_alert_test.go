@@ -2,6 +2,7 @@ package dependency
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -44,7 +45,7 @@ func TestListDependencyAlerts(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 	api.APIImpl = api.NewAPIv1(ts.URL, "")
-	ListDependencyAlerts(&api.Project{Slug: "blah"})
+	ListDependencyAlerts(context.Background(), &api.Project{Slug: "blah"})
 	w.Close()
 	var buf bytes.Buffer
 	io.Copy(&buf, r)
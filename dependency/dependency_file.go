@@ -2,33 +2,32 @@ package dependency
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/gemnasium/depfile"
 	"github.com/gemnasium/toolbelt/api"
 	"github.com/gemnasium/toolbelt/config"
 	"github.com/gemnasium/toolbelt/project"
 	"github.com/olekukonko/tablewriter"
 )
 
-func NewDependencyFile(filePath string) *api.DependencyFile {
-	content, err := ioutil.ReadFile(filePath)
+func NewDependencyFile(filePath string) (*api.DependencyFile, error) {
+	content := bytes.NewBuffer([]byte{})
+	sha, err := hashFile(filePath, content)
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("Unable to read file: %s", err)
 	}
-	sha, err := GetFileSHA1(filePath)
-	if err != nil {
-		return nil
-	}
-	return &api.DependencyFile{Path: filePath, SHA: sha, Content: content}
+	return &api.DependencyFile{Path: filePath, SHA: sha, Content: content.Bytes()}, nil
 }
 
 func DependencyFileCheckFileSHA1(df *api.DependencyFile) error {
@@ -112,22 +111,45 @@ func DependencyFilePatch(df *api.DependencyFile, patch string) error {
 // Return git SHA1 of the given file
 // TODO: Make this generic (ie: working with SVN)
 func GetFileSHA1(filePath string) (string, error) {
-	dat, err := ioutil.ReadFile(filePath)
+	return hashFile(filePath, ioutil.Discard)
+}
+
+// Return the git SHA1 of the given file, reading it once and streaming its
+// content to w as well
+func hashFile(filePath string, w io.Writer) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
 		return "", err
 	}
 	h := sha1.New()
-	header := fmt.Sprintf("blob %d\x00", len(dat))
-	io.WriteString(h, header)
-	io.Copy(h, bytes.NewReader(dat))
-	hash := h.Sum(nil)
-
-	return fmt.Sprintf("%x", hash), nil
+	fmt.Fprintf(h, "blob %d\x00", info.Size())
+	var n int64
+	if b, ok := w.(*bytes.Buffer); ok {
+		// Read at once, then hashed from memory
+		b.Grow(int(info.Size()) + bytes.MinRead)
+		start := b.Len()
+		if n, err = b.ReadFrom(f); err != nil {
+			return "", err
+		}
+		h.Write(b.Bytes()[start:])
+	} else if n, err = io.Copy(io.MultiWriter(h, w), f); err != nil {
+		return "", err
+	}
+	// The size is in the header, so the file must not change while read
+	if n != info.Size() {
+		return "", fmt.Errorf("%s: file changed while being read", filePath)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
-func ListDependencyFiles(p *api.Project) error {
+func ListDependencyFiles(ctx context.Context, p *api.Project) error {
 
-	dfiles, err := project.ProjectDependencyFiles(p)
+	dfiles, err := project.ProjectDependencyFiles(ctx, p)
 	if err != nil {
 		return err
 	}
@@ -143,146 +165,157 @@ func ListDependencyFiles(p *api.Project) error {
 	return nil
 }
 
-var getLocalDependencyFiles = func(rootPath string) ([]*api.DependencyFile, error) {
-	dfiles := []*api.DependencyFile{}
-	excludeDirectory :=map[string]bool{
-		"node_modules": true,
-		".bundle": true,
-		"vendor": true,
-		".git": true,
-	}
-	searchDeps := func(path string, info os.FileInfo, err error) error {
-		// Get path relative to rootPath, we don't want to take wrongly into account
-		// the elements of rootPath
-		relativePath, err := filepath.Rel(rootPath, path)
-		if err != nil {
-			return err
-		}
-		// Skip excluded directories
-		for _, pathComponent := range filepath.SplitList(relativePath) {
-			if excludeDirectory[pathComponent] {
-				return filepath.SkipDir
-			}
+// Search the dependency files of project p in rootPath, its directory
+// (see searchDependencyFiles), and return the selected ones. Their content
+// is read and hashed concurrently, and they're returned in the order found.
+var getLocalDependencyFiles = func(rootPath string, p config.SubProject) ([]*api.DependencyFile, error) {
+	var selected []string
+	err := searchDependencyFiles(rootPath, p, func(s Selection) {
+		if printSelection(s) {
+			selected = append(selected, s.Path)
 		}
-		// Skip ignored_pathes
-		for _, ignoredPath := range config.IgnoredPaths {
-			// Old behavior, keep it in case users rely on it
-			matched1, err := filepath.Match(filepath.Clean(ignoredPath), info.Name())
-			if err != nil {
-				return err
-			}
-			// Actual match on the path
-			matched2, err := filepath.Match(filepath.Clean(ignoredPath), relativePath)
-			if err != nil {
-				return err
-			}
+	})
+	if err != nil {
+		return []*api.DependencyFile{}, err
+	}
 
-			if matched1 || matched2 {
-				fmt.Println("Skipping", info.Name())
-				return filepath.SkipDir
+	found := make([]*api.DependencyFile, len(selected))
+	errs := make([]error, len(selected))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < scanWorkers && w < len(selected); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				found[i], errs[i] = NewDependencyFile(filepath.Join(rootPath, filepath.FromSlash(selected[i])))
 			}
-		}
+		}()
+	}
+	for i := range selected {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		if df := depfile.Find(path); df != nil {
-			fmt.Printf("Found: %s (%s)\n", relativePath, df.Name)
-			dfile := NewDependencyFile(path)
-			// Remove the rootPath from the path field of dfile to keep things clean.
-			// we want pathes relative to the project's root
-			dfile.Path, err = filepath.Rel(rootPath, dfile.Path)
-			if err != nil {
-				return err
-			}
-			dfiles = append(dfiles, dfile)
+	dfiles := []*api.DependencyFile{}
+	for i, dfile := range found {
+		if errs[i] != nil {
+			return dfiles, errs[i]
 		}
-		return nil
+		// We want pathes relative to the project's root
+		dfile.Path = filepath.FromSlash(selected[i])
+		dfiles = append(dfiles, dfile)
 	}
-	// Walk the directory
-	err := filepath.Walk(rootPath, searchDeps)
+	return dfiles, nil
+}
+
+// Print the dependency file found, or skipped because of ignored_paths,
+// and tell whether it's selected
+func printSelection(s Selection) bool {
+	if s.Source == "ignored_paths" {
+		fmt.Println("Skipping", path.Base(s.Path))
+	}
+	if !s.Selected {
+		return false
+	}
+	fmt.Printf("Found: %s (%s)\n", s.Path, s.Type)
+	return true
+}
+
+// Return the directories of the project holding dependency files, other
+// than its root, sorted
+func DependencyDirs() ([]string, error) {
+	dfiles, err := getLocalDependencyFiles(config.ProjectDir, config.SubProject{Path: "."})
 	if err != nil {
-		return dfiles, err
+		return nil, err
 	}
-	return dfiles, nil
+	found := map[string]bool{}
+	dirs := []string{}
+	for _, df := range dfiles {
+		dir := filepath.ToSlash(filepath.Dir(df.Path))
+		if dir != "." && !found[dir] {
+			found[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
 }
 
 // Push project dependencies
-// The current path will be scanned for supported dependency files.
-func PushDependencyFiles(projectSlug string, files []string) error {
-	dfiles, err := LookupDependencyFiles(files)
+// The directory of the project will be scanned for supported dependency files.
+// Read from the working tree, they must be committed at the revision pushed,
+// unless allowDirty is set.
+func PushDependencyFiles(ctx context.Context, p config.SubProject, files []string, allowDirty bool) error {
+	dfiles, err := LookupDependencyFiles(p, files)
 	if err != nil {
 		return err
 	}
-
-	fmt.Printf("Sending files to Gemnasium: ")
-	// API v1 and v2 returns completelly different informations
-	switch a := api.APIImpl.(type) {
-	case *api.APIv1:
-		jsonResp, err := a.DependencyFilesPush(projectSlug, dfiles)
-		if err != nil {
-			return err
-		}
-
-		added := []string{}
-		for _, df := range jsonResp["added"] {
-			added = append(added, df.Path)
-		}
-		updated := []string{}
-		for _, df := range jsonResp["updated"] {
-			updated = append(updated, df.Path)
-		}
-		unchanged := []string{}
-		for _, df := range jsonResp["unchanged"] {
-			unchanged = append(unchanged, df.Path)
+	if config.Revision == "" {
+		// The paths of the files found are relative to the project
+		dir := "."
+		if len(files) == 0 {
+			dir = projectDir(p)
 		}
-		unsupported := []string{}
-		for _, df := range jsonResp["unsupported"] {
-			unsupported = append(unsupported, df.Path)
+		// The push is tagged with the revision of the REVISION env var, or
+		// else HEAD (see utils.GetCurrentRevision)
+		revision := "HEAD"
+		if env := os.Getenv(config.ENV_REVISION); env != "" {
+			revision = env
 		}
-		fmt.Printf("done.\n\n")
-		fmt.Printf("Added: %s\n", strings.Join(added, ", "))
-		fmt.Printf("Updated: %s\n", strings.Join(updated, ", "))
-		fmt.Printf("Unchanged: %s\n", strings.Join(unchanged, ", "))
-		fmt.Printf("Unsupported: %s\n", strings.Join(unsupported, ", "))
-	case *api.V2ToV1:
-		//Converts dfiles to v2
-		v2dfiles := []*api.V2DependencyFile{}
-		for _, dfile := range dfiles {
-			v2dfile := api.V2DependencyFile{}
-			api.V1DependencyFileToV2(dfile, &v2dfile)
-			// Base64 encode content
-			v2dfile.Content = base64.StdEncoding.EncodeToString([]byte(v2dfile.Content))
-			v2dfiles = append(v2dfiles, &v2dfile)
-		}
-		jsonResp, err := a.APIv2.DependencyFilesPush(projectSlug, v2dfiles)
-		if err != nil {
+		if err := checkDirtyFiles(dir, revision, dfiles, allowDirty); err != nil {
 			return err
 		}
+	}
 
-		fmt.Printf("Commit SHA %s in branch %s has been pushed.\n", jsonResp.CommitSHA, jsonResp.Branch)
-		fmt.Printf("done.\n\n")
+	fmt.Printf("Sending files to Gemnasium: ")
+	result, err := api.APIImpl.DependencyFilesPush(ctx, p.Slug, dfiles)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("done.\n\n")
+	if result.CommitSHA != "" {
+		fmt.Printf("Commit SHA %s in branch %s has been pushed.\n", result.CommitSHA, result.Branch)
+	}
+	if result.HasFileStatuses() {
+		fmt.Printf("Added: %s\n", strings.Join(paths(result.Added), ", "))
+		fmt.Printf("Updated: %s\n", strings.Join(paths(result.Updated), ", "))
+		fmt.Printf("Unchanged: %s\n", strings.Join(paths(result.Unchanged), ", "))
+		fmt.Printf("Unsupported: %s\n", strings.Join(paths(result.Unsupported), ", "))
 	}
 
 	return nil
 }
 
-// Load dependency files if files is not empty, otherwise search in the current
-// path for files
-func LookupDependencyFiles(files []string) (dfiles []*api.DependencyFile, err error) {
+func paths(dfiles []api.DependencyFile) []string {
+	paths := []string{}
+	for _, df := range dfiles {
+		paths = append(paths, df.Path)
+	}
+	return paths
+}
+
+// Load dependency files if files is not empty, otherwise search in the
+// directory of project p for files, relative to the directory of the
+// project config file
+func LookupDependencyFiles(p config.SubProject, files []string) (dfiles []*api.DependencyFile, err error) {
+	if config.Revision != "" {
+		return lookupRevisionDependencyFiles(config.Revision, p, files)
+	}
 	if len(files) > 0 {
 		for _, path := range files {
-			df := NewDependencyFile(path)
-			if df == nil {
-				err = fmt.Errorf("Unable to read file: %s", path)
+			df, err := NewDependencyFile(path)
+			if err != nil {
 				return dfiles, err
 			}
 			dfiles = append(dfiles, df)
 		}
 	} else {
-		fmt.Println("[warning] No files given, scanning current directory instead.")
-		currentDir, err := os.Getwd()
-		if err != nil {
-			return dfiles, err
-		}
-		files, err := getLocalDependencyFiles(currentDir)
+		dir := projectDir(p)
+		fmt.Printf("[warning] No files given, scanning %s instead.\n", describeDir(dir))
+		files, err := getLocalDependencyFiles(dir, p)
 		if err != nil {
 			return nil, err
 		}
@@ -290,3 +323,19 @@ func LookupDependencyFiles(files []string) (dfiles []*api.DependencyFile, err er
 	}
 	return dfiles, nil
 }
+
+// Return the directory of project p
+func projectDir(p config.SubProject) string {
+	return filepath.Join(config.ProjectDir, filepath.FromSlash(p.Path))
+}
+
+// Describe dir, relative to the current directory
+func describeDir(dir string) string {
+	where := "current directory"
+	if wd, err := os.Getwd(); err == nil && wd != dir {
+		if where, err = filepath.Rel(wd, dir); err != nil {
+			where = dir
+		}
+	}
+	return where
+}
@@ -1,7 +1,10 @@
 package dependency
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -9,9 +12,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
 
+	"github.com/gemnasium/depfile"
 	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/ignore"
 	"path/filepath"
 	"reflect"
 	"encoding/json"
@@ -40,9 +47,13 @@ func TestNewDependencyFile(t *testing.T) {
 	defer os.Remove(tmp.Name())
 	defer tmp.Close()
 
-	df := NewDependencyFile(tmp.Name())
-	if df == nil {
-		t.Errorf("NewDependencyFile returned nil")
+	df, err := NewDependencyFile(tmp.Name())
+	if err != nil || df == nil {
+		t.Errorf("NewDependencyFile returned nil: %v", err)
+	}
+
+	if _, err := NewDependencyFile(tmp.Name() + "-missing"); err == nil {
+		t.Error("Expected an error for a missing file")
 	}
 }
 
@@ -60,7 +71,10 @@ func TestCheckFileSHA1(t *testing.T) {
 		t.Error(err)
 	}
 
-	df := NewDependencyFile(tmp.Name())
+	df, err := NewDependencyFile(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if df.SHA != tf.SHA {
 		t.Errorf("DependencyFile has an invalid SHA (Exp: '%s', Got: '%s')\n", tf.SHA, df.SHA)
@@ -84,7 +98,10 @@ func TestPatch(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	df := NewDependencyFile(tmp.Name())
+	df, err := NewDependencyFile(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	patch := "--- %s\n+++ titi\n@@ -1,3 +1,3 @@\n source 'https://rubygems.org'\n\n-gem 'rails', '3.2.18'\n+gem 'rails', '3.2.21'\n"
 	expected := "source 'https://rubygems.org'\n\ngem 'rails', '3.2.21'\n"
@@ -113,7 +130,10 @@ func TestUpdate(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	df := NewDependencyFile(tmp.Name())
+	df, err := NewDependencyFile(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	newContent := "source 'https://rubygems.org'\n\ngem 'rails', '4.1.1'\n"
 	_, err = tmp.WriteAt([]byte(newContent), 0)
@@ -175,7 +195,7 @@ func TestGetLocalDependencyFiles(t *testing.T) {
 	}
 	config.IgnoredPaths = []string{"sub1/sub2/Gemfile", "sub3/sub4"}
 	// Get a list of recognised dependency files from test data
-	result, err := getLocalDependencyFiles(filepath.Join("testdata", "test_get_local_dependency_files"))
+	result, err := getLocalDependencyFiles(filepath.Join("testdata", "test_get_local_dependency_files"), config.SubProject{Path: "."})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -184,6 +204,445 @@ func TestGetLocalDependencyFiles(t *testing.T) {
 	}
 }
 
+func TestGetLocalDependencyFilesOfProjects(t *testing.T) {
+	root := filepath.Join("testdata", "test_get_local_dependency_files")
+	config.IgnoredPaths = nil
+	config.Projects = []config.SubProject{
+		{Path: "sub1", Slug: "sub1-slug"},
+		{Path: "sub1/sub2", Slug: "sub2-slug"},
+		{Path: "sub3", Slug: "sub3-slug", IgnoredPaths: []string{"sub4"}},
+	}
+	defer func() { config.Projects = nil }()
+
+	var tests = []struct {
+		Project config.SubProject
+		Paths   []string
+	}{
+		// The directories of the projects are skipped
+		{config.SubProject{Path: "."}, []string{"Gemfile", "subdir/gems.rb"}},
+		// Nested projects too
+		{config.Projects[0], []string{}},
+		{config.Projects[1], []string{"Gemfile"}},
+		// With the ignored paths of the project
+		{config.Projects[2], []string{}},
+	}
+	for _, test := range tests {
+		dfiles, err := getLocalDependencyFiles(filepath.Join(root, filepath.FromSlash(test.Project.Path)), test.Project)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(derefs(dfiles)); !reflect.DeepEqual(got, test.Paths) {
+			t.Errorf("Expected files of %s to be %v, got %v", test.Project.Path, test.Paths, got)
+		}
+	}
+}
+
+func TestGetLocalDependencyFilesIgnoreFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		".gitignore":                          "build/\n/fixtures\n*.lock\n",
+		".gemnasiumignore":                    "!Gemfile.lock\n",
+		"Gemfile.lock":                        "",
+		"yarn.lock":                           "",
+		"build/package.json":                  "",
+		"fixtures/Gemfile":                    "",
+		"apps/fixtures/Gemfile":               "",
+		"apps/.gitignore":                     "/Gemfile\n",
+		"apps/Gemfile":                        "",
+		"apps/js/node_modules/x/package.json": "",
+		"apps/js/bower_components/bower.json": "",
+		"apps/js/package.json":                "",
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.IgnoredPaths = nil
+	config.ExcludedDirs = []string{"node_modules", "bower_components"}
+	defer func() { config.ExcludedDirs = config.DEFAULT_EXCLUDED_DIRS }()
+
+	dfiles, err := getLocalDependencyFiles(dir, config.SubProject{Path: "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Gemfile.lock", "apps/fixtures/Gemfile", "apps/js/package.json"}
+	var got []string
+	for _, df := range dfiles {
+		got = append(got, filepath.ToSlash(df.Path))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected files %v, got %v", expected, got)
+	}
+}
+
+func TestSearchDependencyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, path := range []string{"Gemfile", "spec/fixtures/Gemfile", "services/api/package.json", "services/api/spec/Gemfile", "tools/requirements.txt"} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.IgnoredPaths = []string{"spec/**/Gemfile"}
+	config.IncludePaths = []string{"services/*/", "Gemfile"}
+	defer func() { config.IgnoredPaths, config.IncludePaths = nil, nil }()
+
+	var got []string
+	err = searchDependencyFiles(dir, config.SubProject{Path: "."}, func(s Selection) {
+		got = append(got, fmt.Sprintf("%s %v %s", s.Path, s.Selected, s.Reason()))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"Gemfile true include_paths: Gemfile",
+		"services/api/package.json true include_paths: services/*/",
+		"services/api/spec/Gemfile true include_paths: services/*/",
+		"spec/fixtures/Gemfile false ignored_paths: spec/**/Gemfile",
+		"tools/requirements.txt false not matched by include_paths",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// The files are sorted like filepath.Walk does, whatever the number of workers
+func TestGetLocalDependencyFilesOrder(t *testing.T) {
+	dir := writeTree(t, []string{"a-b/Gemfile", "a/b/Gemfile", "a/Gemfile", "Gemfile", "b/package.json", "a/b-c/Gemfile"})
+	defer os.RemoveAll(dir)
+	expected := []string{"Gemfile", "a/Gemfile", "a/b/Gemfile", "a/b-c/Gemfile", "a-b/Gemfile", "b/package.json"}
+
+	defer func(workers int) { scanWorkers = workers }(scanWorkers)
+	for _, workers := range []int{1, 8} {
+		scanWorkers = workers
+		dfiles, err := getLocalDependencyFiles(dir, config.SubProject{Path: "."})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, df := range dfiles {
+			got = append(got, filepath.ToSlash(df.Path))
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("With %d workers, expected files %v, got %v", workers, expected, got)
+		}
+	}
+}
+
+func TestGetRevisionDependencyFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is required")
+	}
+	dir := writeTree(t, []string{"Gemfile", "app/Gemfile", "app/tmp/Gemfile", "app/spec/Gemfile", "app/js/package.json"})
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("tmp/\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app", ".gemnasiumignore"), []byte("spec/\n"), 0644)
+	for _, args := range [][]string{{"init", "-q"}, {"add", "-f", "."}, {"commit", "-q", "-m", "First"}} {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s\n%s", args, err, out)
+		}
+	}
+	// Neither the uncommitted files nor the changes are read
+	ioutil.WriteFile(filepath.Join(dir, "app", "gems.rb"), []byte{}, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app", "Gemfile"), []byte("gem 'uncommitted'\n"), 0644)
+
+	dfiles, err := getRevisionDependencyFiles("HEAD", filepath.Join(dir, "app"), config.SubProject{Path: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, df := range dfiles {
+		got = append(got, filepath.ToSlash(df.Path))
+		if sha, _ := GetFileSHA1(filepath.Join(dir, "Gemfile")); df.SHA != sha || string(df.Content) != "source 'https://rubygems.org'\n" {
+			t.Errorf("Expected %s to be read from the revision, got %s %q", df.Path, df.SHA, df.Content)
+		}
+	}
+	// tmp/ is ignored by .gitignore at the root, spec/ by app/.gemnasiumignore
+	if expected := []string{"Gemfile", "js/package.json"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected files %v, got %v", expected, got)
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(filepath.Join(dir, "app"))
+	dfiles, err = lookupRevisionDependencyFiles("HEAD", config.SubProject{Path: "."}, []string{"Gemfile"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dfiles) != 1 || dfiles[0].Path != "Gemfile" || string(dfiles[0].Content) != "source 'https://rubygems.org'\n" {
+		t.Errorf("Expected the committed Gemfile, got %v", derefs(dfiles))
+	}
+	if _, err := lookupRevisionDependencyFiles("HEAD", config.SubProject{Path: "."}, []string{"gems.rb"}); err == nil {
+		t.Error("Expected an error for a file missing at the revision")
+	}
+}
+
+// A file that can't be read fails the scan, instead of being left out
+func TestGetLocalDependencyFilesReadError(t *testing.T) {
+	dir := writeTree(t, []string{"Gemfile"})
+	defer os.RemoveAll(dir)
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "Gemfile.lock")); err != nil {
+		t.Skip(err)
+	}
+	if _, err := getLocalDependencyFiles(dir, config.SubProject{Path: "."}); err == nil || !strings.Contains(err.Error(), "Unable to read file") {
+		t.Errorf("Expected a read error, got %v", err)
+	}
+}
+
+func TestReadBlobs(t *testing.T) {
+	out := "HEAD:missing missing\n0123abcd blob 4\ngem\n\n"
+	blobs, err := readBlobs(bufio.NewReader(strings.NewReader(out)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobs[0] != nil || blobs[1].SHA != "0123abcd" || string(blobs[1].Content) != "gem\n" {
+		t.Errorf("Unexpected blobs %v %v", blobs[0], blobs[1])
+	}
+	if _, err := readBlobs(bufio.NewReader(strings.NewReader("fatal: oops\n")), 1); err == nil {
+		t.Error("Expected an error for an unexpected output")
+	}
+}
+
+func TestGetDirtyFilesOutsideRepository(t *testing.T) {
+	dir := writeTree(t, []string{"Gemfile"})
+	defer os.RemoveAll(dir)
+	df, err := NewDependencyFile(filepath.Join(dir, "Gemfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files outside of a git repository aren't checked, without running git
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", "")
+	if dirty, err := getDirtyFiles(dir, "HEAD", []*api.DependencyFile{df}); err != nil || len(dirty) != 0 {
+		t.Errorf("Expected no dirty files outside of a repository, got %v %v", dirty, err)
+	}
+	// But in a repository, failing to run git is an error
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getDirtyFiles(dir, "HEAD", []*api.DependencyFile{df}); err == nil {
+		t.Error("Expected an error when git can't be run")
+	}
+}
+
+// Files checked out with CRLF line endings match their committed blob
+func TestGetDirtyFilesWithEOLConversion(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is required")
+	}
+	tests := []struct {
+		name       string
+		config     []string
+		attributes string
+	}{
+		{"core.autocrlf", []string{"-c", "core.autocrlf=true"}, ""},
+		{"gitattributes", nil, "* text eol=crlf\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{
+				"Gemfile":      "source 'https://rubygems.org'\r\ngem 'rails'\r\n",
+				"Gemfile.lock": "GEM\r\n  specs:\r\n",
+			}
+			if tt.attributes != "" {
+				files[".gitattributes"] = tt.attributes
+			}
+			for name, content := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			git := func(args ...string) {
+				args = append(append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, tt.config...), args...)
+				cmd := exec.Command("git", args...)
+				cmd.Dir = dir
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("git %v: %s\n%s", args, err, out)
+				}
+			}
+			git("init", "-q")
+			if tt.config != nil {
+				git("config", "core.autocrlf", "true")
+			}
+			git("add", ".")
+			git("commit", "-q", "-m", "First")
+
+			ioutil.WriteFile(filepath.Join(dir, "Gemfile"), []byte("source 'https://rubygems.org'\r\ngem 'rack'\r\n"), 0644)
+			ioutil.WriteFile(filepath.Join(dir, "gems.rb"), []byte("gem 'rails'\r\n"), 0644)
+			var dfiles []*api.DependencyFile
+			for _, name := range []string{"Gemfile", "Gemfile.lock", "gems.rb"} {
+				df, err := NewDependencyFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				df.Path = name
+				dfiles = append(dfiles, df)
+			}
+			dirty, err := getDirtyFiles(dir, "HEAD", dfiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := []string{"modified: Gemfile", "untracked: gems.rb"}; !reflect.DeepEqual(dirty, expected) {
+				t.Errorf("Expected dirty files %v, got %v", expected, dirty)
+			}
+		})
+	}
+}
+
+// Create the files at paths in a new temporary directory, and return it
+func writeTree(tb testing.TB, paths []string) string {
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, path := range paths {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("source 'https://rubygems.org'\n"), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Compare the scan of a large monorepo with the sequential walk reading each
+// file twice that it replaced, and with one or scanWorkers workers
+func BenchmarkGetLocalDependencyFiles(b *testing.B) {
+	var paths []string
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 10; j++ {
+			dir := fmt.Sprintf("apps/app%d/lib%d/", i, j)
+			paths = append(paths, dir+"Gemfile", dir+"Gemfile.lock", dir+"README.md", dir+"main.rb")
+		}
+	}
+	dir := writeTree(b, paths)
+	defer os.RemoveAll(dir)
+	// Lockfiles are the largest dependency files
+	lockfile := bytes.Repeat([]byte("    rails (5.1.4)\n"), 2000)
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".lock") {
+			ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(path)), lockfile, 0644)
+		}
+	}
+
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stdout = stdout }()
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := sequentialLocalDependencyFiles(dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	defer func(workers int) { scanWorkers = workers }(scanWorkers)
+	for _, workers := range []int{1, scanWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			scanWorkers = workers
+			for i := 0; i < b.N; i++ {
+				if _, err := getLocalDependencyFiles(dir, config.SubProject{Path: "."}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Baseline of BenchmarkGetLocalDependencyFiles: the files are searched with
+// filepath.Walk, then read, and read again to be hashed
+func sequentialLocalDependencyFiles(rootPath string) ([]*api.DependencyFile, error) {
+	ignored, err := ignore.ForTree(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	var dfiles []*api.DependencyFile
+	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != rootPath && ignored.Match(path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return ignored.AddDir(path)
+		}
+		if depfile.Find(path) == nil {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		h := sha1.New()
+		fmt.Fprintf(h, "blob %d\x00", len(dat))
+		h.Write(dat)
+		dfiles = append(dfiles, &api.DependencyFile{Path: path, SHA: fmt.Sprintf("%x", h.Sum(nil)), Content: content})
+		return nil
+	})
+	return dfiles, err
+}
+
+// Compare the single read of NewDependencyFile with the read of the file
+// followed by GetFileSHA1, as it used to be done
+func BenchmarkNewDependencyFile(b *testing.B) {
+	dir := writeTree(b, []string{"Gemfile.lock"})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "Gemfile.lock")
+	ioutil.WriteFile(path, bytes.Repeat([]byte("    rails (5.1.4)\n"), 50000), 0644)
+
+	b.Run("read twice", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ioutil.ReadFile(path); err != nil {
+				b.Fatal(err)
+			}
+			dat, err := ioutil.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			h := sha1.New()
+			fmt.Fprintf(h, "blob %d\x00", len(dat))
+			h.Write(dat)
+		}
+	})
+	b.Run("single read", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewDependencyFile(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func derefs(dfiles []*api.DependencyFile) []api.DependencyFile {
+	values := []api.DependencyFile{}
+	for _, df := range dfiles {
+		values = append(values, *df)
+	}
+	return values
+}
+
 func TestListDependencyFiles(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		r.Header.Set("Content-Type", "application/json")
@@ -201,7 +660,7 @@ func TestListDependencyFiles(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 	api.APIImpl = api.NewAPIv1(ts.URL, "")
-	err := ListDependencyFiles(&api.Project{Slug: "blah"})
+	err := ListDependencyFiles(context.Background(), &api.Project{Slug: "blah"})
 	if err != nil {
 		t.Error(err)
 	}
@@ -244,7 +703,9 @@ func TestPushDependencyFiles(t *testing.T) {
 	os.Stdout = w
 	api.APIImpl = api.NewAPIv1(ts.URL, "")
 
-	getLocalDependencyFiles = func(path string) ([]*api.DependencyFile, error) {
+	orgLocal, orgDirty := getLocalDependencyFiles, getDirtyFiles
+	defer func() { getLocalDependencyFiles, getDirtyFiles = orgLocal, orgDirty }()
+	getLocalDependencyFiles = func(path string, p config.SubProject) ([]*api.DependencyFile, error) {
 		return []*api.DependencyFile{
 			&api.DependencyFile{Path: "Gemfile", SHA: "Gemfile SHA-1", Content: []byte("Gemfile.lock base64 encoded content")},
 			&api.DependencyFile{Path: "Gemfile.lock", SHA: "Gemfile.lock SHA-1", Content: []byte("Gemfile base64 encoded content")},
@@ -252,7 +713,11 @@ func TestPushDependencyFiles(t *testing.T) {
 		}, nil
 	}
 
-	err := PushDependencyFiles("blah", []string{})
+	getDirtyFiles = func(dir, revision string, dfiles []*api.DependencyFile) ([]string, error) {
+		return nil, nil
+	}
+
+	err := PushDependencyFiles(context.Background(), config.SubProject{Path: ".", Slug: "blah"}, []string{}, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -2,6 +2,7 @@ package dependency
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,8 +11,13 @@ import (
 	"testing"
 
 	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config/configtest"
 )
 
+func TestMain(m *testing.M) {
+	os.Exit(configtest.Run(m))
+}
+
 func TestListDependencies(t *testing.T) {
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -63,7 +69,7 @@ func TestListDependencies(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 	api.APIImpl = api.NewAPIv1(ts.URL, "")
-	ListDependencies(&api.Project{Slug: "blah"})
+	ListDependencies(context.Background(), &api.Project{Slug: "blah"})
 	w.Close()
 	var buf bytes.Buffer
 	io.Copy(&buf, r)
@@ -0,0 +1,156 @@
+package dependency
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/utils"
+)
+
+// Return the dependency files which differ from their blob at revision
+// (ex: HEAD), as "modified: path", or which aren't committed at revision, as
+// "untracked: path". Their paths are relative to dir. The files outside of a
+// git repository aren't checked.
+// Lambda to be overriden in tests
+var getDirtyFiles = func(dir, revision string, dfiles []*api.DependencyFile) ([]string, error) {
+	// The files are checked at once in each git repository
+	var roots []string
+	names := map[string][]string{}
+	indexes := map[string][]int{}
+	rootOf := map[string]string{} // "" outside of a git repository
+	for i, df := range dfiles {
+		path := df.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		abs, err := realPath(path)
+		if err != nil {
+			return nil, err
+		}
+		root, ok := rootOf[filepath.Dir(abs)]
+		if !ok {
+			if root, err = gitRoot(filepath.Dir(abs)); err != nil && err != errNotInRepository {
+				return nil, err
+			}
+			rootOf[filepath.Dir(abs)] = root
+		}
+		if root == "" {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := names[root]; !ok {
+			roots = append(roots, root)
+		}
+		names[root] = append(names[root], filepath.ToSlash(rel))
+		indexes[root] = append(indexes[root], i)
+	}
+	committed := make([]string, len(dfiles))
+	current := make([]string, len(dfiles))
+	checked := make([]bool, len(dfiles))
+	for _, root := range roots {
+		// HEAD is left as is, for the repositories without commits
+		sha := revision
+		if revision != "HEAD" {
+			resolved, err := utils.ResolveRevisionIn(root, revision)
+			if err != nil {
+				return nil, fmt.Errorf("%s, can't compare the dependency files with the revision pushed", err)
+			}
+			sha = resolved
+		}
+		objects := make([]string, len(names[root]))
+		for j, name := range names[root] {
+			objects[j] = sha + ":" + name
+		}
+		blobs, err := blobSHAs(root, objects)
+		if err != nil {
+			return nil, err
+		}
+		hashes, err := hashObjects(root, names[root])
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range indexes[root] {
+			committed[i], current[i], checked[i] = blobs[j], hashes[j], true
+		}
+	}
+	var dirty []string
+	for i, df := range dfiles {
+		switch {
+		case !checked[i] || committed[i] == current[i]:
+		case committed[i] == "":
+			dirty = append(dirty, "untracked: "+df.Path)
+		default:
+			dirty = append(dirty, "modified: "+df.Path)
+		}
+	}
+	return dirty, nil
+}
+
+// Fail if some of the dependency files, relative to dir, aren't committed at
+// revision, or only warn about it if allowDirty is set
+func checkDirtyFiles(dir, revision string, dfiles []*api.DependencyFile, allowDirty bool) error {
+	dirty, err := getDirtyFiles(dir, revision, dfiles)
+	if err != nil || len(dirty) == 0 {
+		return err
+	}
+	list := "  " + strings.Join(dirty, "\n  ")
+	if allowDirty {
+		fmt.Printf("[warning] Pushing uncommitted changes of dependency files:\n%s\n", list)
+		return nil
+	}
+	return errors.New("Uncommitted changes in dependency files:\n" + list + "\nCommit them, push a committed revision with --revision, or use --allow-dirty to push them anyway.")
+}
+
+// Return the SHA of the blobs of the git repository at root named by names
+// (ex: HEAD:Gemfile), "" for the missing ones
+func blobSHAs(root string, names []string) ([]string, error) {
+	cmd := exec.Command(utils.GitPath(), "cat-file", "--batch-check")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(names, "\n") + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to check the files with git cat-file: %s", err)
+	}
+	var shas []string
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		// <sha> SP <type> SP <size>, or <name> SP missing
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[1] == "blob" && !strings.HasSuffix(scanner.Text(), " missing") {
+			shas = append(shas, fields[0])
+		} else {
+			shas = append(shas, "")
+		}
+	}
+	if len(shas) != len(names) {
+		return nil, fmt.Errorf("Unexpected output of git cat-file: %q", out)
+	}
+	return shas, nil
+}
+
+// Return the SHA of the blobs git would store for the files of the git
+// repository at root, with their paths relative to root. Unlike the SHA of
+// the content of the files, git applies its clean filters (ex: core.autocrlf,
+// eol attributes, LFS), so that a checked out file matches its blob.
+func hashObjects(root string, paths []string) ([]string, error) {
+	cmd := exec.Command(utils.GitPath(), "hash-object", "--stdin-paths")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to check the files with git hash-object: %s", err)
+	}
+	shas := strings.Fields(string(out))
+	if len(shas) != len(paths) {
+		return nil, fmt.Errorf("Unexpected output of git hash-object: %q", out)
+	}
+	return shas, nil
+}
@@ -0,0 +1,346 @@
+package dependency
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/gemnasium/toolbelt/ignore"
+	"github.com/gemnasium/toolbelt/utils"
+)
+
+// An entry of a git tree, as listed by git ls-tree
+type treeEntry struct {
+	Mode string
+	Type string // blob, tree or commit (submodules)
+	SHA  string
+	Path string // Relative to the root of the repository, with slashes
+}
+
+// Load the files at revision if files is not empty, otherwise search the
+// dependency files of project p at revision. The files are read from the
+// git object database, so the uncommitted changes are left out.
+func lookupRevisionDependencyFiles(revision string, p config.SubProject, files []string) ([]*api.DependencyFile, error) {
+	dir := projectDir(p)
+	if len(files) == 0 {
+		fmt.Printf("[warning] No files given, scanning %s at revision %s instead.\n", describeDir(dir), revision)
+		return getRevisionDependencyFiles(revision, dir, p)
+	}
+	root, err := revisionRoot(".")
+	if err != nil {
+		return nil, err
+	}
+	if revision, err = utils.ResolveRevisionIn(root, revision); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		abs, err := realPath(file)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("Unable to read file: %s is outside of the git repository", file)
+		}
+		names = append(names, revision+":"+filepath.ToSlash(rel))
+	}
+	blobs, err := catBlobs(root, names)
+	if err != nil {
+		return nil, err
+	}
+	dfiles := []*api.DependencyFile{}
+	for i, blob := range blobs {
+		if blob == nil {
+			return nil, fmt.Errorf("Unable to read file: %s at revision %s", files[i], revision)
+		}
+		blob.Path = files[i]
+		dfiles = append(dfiles, blob)
+	}
+	return dfiles, nil
+}
+
+// Search the dependency files of project p in rootPath, its directory, at
+// revision, and return the selected ones. The files are selected like
+// searchDependencyFiles does in the working tree, with the ignore files of
+// the revision.
+var getRevisionDependencyFiles = func(revision, rootPath string, p config.SubProject) ([]*api.DependencyFile, error) {
+	root, err := revisionRoot(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if revision, err = utils.ResolveRevisionIn(root, revision); err != nil {
+		return nil, err
+	}
+	absPath, err := realPath(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return nil, err
+	}
+	prefix = strings.TrimPrefix(filepath.ToSlash(prefix), ".")
+	entries, err := listTree(root, revision)
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := revisionIgnoreMatcher(root, revision, prefix, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	// The trees are listed before their entries, so the directories skipped
+	// are known when their entries come
+	s := newSearch(absPath, p)
+	walked := map[string]bool{".": true}
+	shas := map[string]string{}
+	for _, entry := range entries {
+		rel := entry.Path
+		if prefix != "" {
+			if !strings.HasPrefix(rel, prefix+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(rel, prefix+"/")
+		}
+		isDir := entry.Type == "tree"
+		// Symlinks and submodules aren't dependency files
+		if !walked[path.Dir(rel)] || (!isDir && (entry.Type != "blob" || entry.Mode == "120000")) {
+			continue
+		}
+		selection, descend := s.decide(filepath.Join(absPath, filepath.FromSlash(rel)), rel, isDir, ignored)
+		if selection != nil {
+			s.selections = append(s.selections, *selection)
+			shas[rel] = entry.SHA
+		}
+		walked[rel] = descend
+	}
+
+	var selected, names []string
+	s.report(func(s Selection) {
+		if printSelection(s) {
+			selected = append(selected, s.Path)
+			names = append(names, shas[s.Path])
+		}
+	})
+	blobs, err := catBlobs(root, names)
+	if err != nil {
+		return nil, err
+	}
+	dfiles := []*api.DependencyFile{}
+	for i, blob := range blobs {
+		if blob == nil {
+			return nil, fmt.Errorf("Unable to read file: %s at revision %s", selected[i], revision)
+		}
+		// We want pathes relative to the project's root
+		blob.Path = filepath.FromSlash(selected[i])
+		dfiles = append(dfiles, blob)
+	}
+	return dfiles, nil
+}
+
+// Return a matcher with .git/info/exclude, and the ignore files of the
+// revision applying to prefix: the ones of its parents and of its
+// subdirectories
+func revisionIgnoreMatcher(root, revision, prefix string, entries []treeEntry) (*ignore.Matcher, error) {
+	ignored := ignore.New(root)
+	if err := ignored.AddFile(filepath.Join(root, ".git", "info", "exclude")); err != nil {
+		return nil, err
+	}
+	var files []treeEntry
+	for _, entry := range entries {
+		dir := path.Dir(entry.Path)
+		if entry.Type != "blob" || fileNameIndex(path.Base(entry.Path)) < 0 {
+			continue
+		}
+		if prefix == "" || dir == "." || dir == prefix || strings.HasPrefix(prefix, dir+"/") || strings.HasPrefix(dir, prefix+"/") {
+			files = append(files, entry)
+		}
+	}
+	// The patterns of the parents come first, and .gemnasiumignore comes
+	// after .gitignore, to override them
+	sort.SliceStable(files, func(i, j int) bool {
+		di, dj := path.Dir(files[i].Path), path.Dir(files[j].Path)
+		if depth(di) != depth(dj) {
+			return depth(di) < depth(dj)
+		}
+		return fileNameIndex(path.Base(files[i].Path)) < fileNameIndex(path.Base(files[j].Path))
+	})
+	var names []string
+	for _, file := range files {
+		names = append(names, file.SHA)
+	}
+	blobs, err := catBlobs(root, names)
+	if err != nil {
+		return nil, err
+	}
+	for i, blob := range blobs {
+		if blob == nil {
+			continue
+		}
+		if err := ignored.AddReader(files[i].Path, bytes.NewReader(blob.Content)); err != nil {
+			return nil, err
+		}
+	}
+	return ignored, nil
+}
+
+// Return the index of name in ignore.FileNames, -1 if it's not there
+func fileNameIndex(name string) int {
+	for i, fileName := range ignore.FileNames {
+		if name == fileName {
+			return i
+		}
+	}
+	return -1
+}
+
+// Return the number of directories of dir, relative and with slashes
+func depth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// Returned by gitRoot outside of a git repository
+var errNotInRepository = errors.New("not in a git repository")
+
+// Return the root of the git repository holding dir, with its symlinks
+// resolved, or errNotInRepository
+func gitRoot(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return "", err
+	}
+	root := ignore.RepositoryRoot(abs)
+	if root == "" {
+		return "", errNotInRepository
+	}
+	return root, nil
+}
+
+// Same as gitRoot, to read files at a revision
+func revisionRoot(dir string) (string, error) {
+	root, err := gitRoot(dir)
+	if err == errNotInRepository {
+		return "", fmt.Errorf("%s is not in a git repository, can't read files at a revision", describeDir(dir))
+	}
+	return root, err
+}
+
+// Return the absolute path of file, with the symlinks of its directory
+// resolved like git does for the root of the repository
+func realPath(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(abs)), nil
+}
+
+// List the files and directories of the git repository at root, at revision,
+// a sha resolved with utils.ResolveRevision
+func listTree(root, revision string) ([]treeEntry, error) {
+	cmd := exec.Command(utils.GitPath(), "ls-tree", "-r", "-t", "-z", "--full-tree", revision)
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the files at revision %s: %s", revision, err)
+	}
+	var entries []treeEntry
+	for _, line := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <sha> TAB <path>
+		tab := strings.IndexByte(line, '\t')
+		if tab < 0 {
+			continue
+		}
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Unexpected output of git ls-tree: %q", line)
+		}
+		entries = append(entries, treeEntry{Mode: fields[0], Type: fields[1], SHA: fields[2], Path: line[tab+1:]})
+	}
+	return entries, nil
+}
+
+// Read the blobs of the git repository at root named by names (ex: a sha,
+// HEAD:Gemfile), with a single git process. The blob of a missing name is
+// nil. The path of the blobs isn't set.
+func catBlobs(root string, names []string) ([]*api.DependencyFile, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	cmd := exec.Command(utils.GitPath(), "cat-file", "--batch")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(names, "\n") + "\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	blobs, readErr := readBlobs(bufio.NewReader(stdout), len(names))
+	if readErr != nil {
+		// git would block writing the rest of its output otherwise
+		io.Copy(ioutil.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("Unable to read the files with git cat-file: %s", err)
+	}
+	return blobs, readErr
+}
+
+// Read count objects from the output of git cat-file --batch
+func readBlobs(r *bufio.Reader, count int) ([]*api.DependencyFile, error) {
+	blobs := make([]*api.DependencyFile, count)
+	for i := range blobs {
+		// <sha> SP <type> SP <size> LF <content> LF, or <name> SP missing LF
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(header, " missing\n") || strings.HasSuffix(header, " ambiguous\n") {
+			continue
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Unexpected output of git cat-file: %q", header)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected output of git cat-file: %q", header)
+		}
+		content := make([]byte, size)
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, err
+		}
+		if _, err := r.Discard(1); err != nil {
+			return nil, err
+		}
+		if fields[1] == "blob" {
+			// The sha of a blob is the one of GetFileSHA1
+			blobs[i] = &api.DependencyFile{SHA: fields[0], Content: content}
+		}
+	}
+	return blobs, nil
+}
@@ -0,0 +1,323 @@
+package dependency
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gemnasium/depfile"
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/gemnasium/toolbelt/ignore"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Decision of the search of dependency files on a dependency file, or on a
+// skipped directory
+type Selection struct {
+	Path     string // Relative to the directory searched, with slashes
+	Type     string // Type of dependency file (ex: Gemfile.lock), "" for directories
+	Dir      bool
+	Selected bool
+	Source   string // Setting or file of the rule deciding it, "" if none
+	Rule     string
+}
+
+// Describe the rule deciding s
+func (s Selection) Reason() string {
+	switch {
+	case s.Source == "include_paths" && s.Rule == "":
+		return "not matched by include_paths"
+	case s.Source == "":
+		return ""
+	case s.Rule == "":
+		return s.Source
+	}
+	return s.Source + ": " + s.Rule
+}
+
+// Number of directories read, and of files hashed, at the same time
+var scanWorkers = 4 * runtime.NumCPU()
+
+// Search the dependency files of project p in rootPath, its directory,
+// calling visit with the decision on each dependency file, and on each
+// directory skipped. The directories skipped are the excluded ones, the
+// ones of the other projects of a monorepo, and the ones ignored by
+// ignored_paths, .gitignore, .git/info/exclude and .gemnasiumignore files.
+// When include_paths is set, only the files it matches are selected.
+// The directories are read by a pool of scanWorkers goroutines, but visit is
+// called in the order of filepath.Walk, once they're all read.
+func searchDependencyFiles(rootPath string, p config.SubProject, visit func(s Selection)) error {
+	root, err := filepath.Abs(rootPath)
+	if err != nil {
+		return err
+	}
+	// Patterns of .gitignore, .git/info/exclude and .gemnasiumignore files
+	ignored, err := ignore.ForTree(root)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+	s := newSearch(root, p)
+	s.queue, s.pending = []dirToWalk{{root, ".", ignored}}, 1
+	var wg sync.WaitGroup
+	for i := 0; i < scanWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	wg.Wait()
+	if s.err != nil {
+		return s.err
+	}
+	s.report(visit)
+	return nil
+}
+
+// State of a search of dependency files, shared by the goroutines reading
+// the directories
+type search struct {
+	root          string
+	ignoredPaths  []string
+	ignoredGlobs  []*ignore.Glob
+	includeGlobs  []*ignore.Glob
+	otherProjects map[string]bool
+	excludedDirs  map[string]bool
+
+	mu         sync.Mutex // Guards the fields below
+	cond       *sync.Cond // Signaled when queue or pending change
+	queue      []dirToWalk
+	pending    int // Directories queued or being read
+	selections []Selection
+	err        error
+}
+
+// A directory to read, at relativePath from the root, with the matcher of
+// its parent
+type dirToWalk struct {
+	dir, relativePath string
+	ignored           *ignore.Matcher
+}
+
+func newSearch(root string, p config.SubProject) *search {
+	s := &search{
+		root:          root,
+		ignoredPaths:  append(append([]string{}, config.IgnoredPaths...), p.IgnoredPaths...),
+		otherProjects: map[string]bool{},
+		excludedDirs:  map[string]bool{},
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i, pattern := range s.ignoredPaths {
+		s.ignoredPaths[i] = filepath.ToSlash(filepath.Clean(pattern))
+		s.ignoredGlobs = append(s.ignoredGlobs, ignore.NewGlob(s.ignoredPaths[i]))
+	}
+	for _, pattern := range config.IncludePaths {
+		s.includeGlobs = append(s.includeGlobs, ignore.NewGlob(strings.TrimSuffix(filepath.ToSlash(pattern), "/")))
+	}
+	for _, other := range config.Projects {
+		switch {
+		case other.Path == p.Path:
+		case p.Path == ".":
+			s.otherProjects[other.Path] = true
+		case strings.HasPrefix(other.Path, p.Path+"/"):
+			s.otherProjects[strings.TrimPrefix(other.Path, p.Path+"/")] = true
+		}
+	}
+	for _, name := range config.ExcludedDirs {
+		s.excludedDirs[name] = true
+	}
+	return s
+}
+
+// Read the queued directories until they're all read, queuing their
+// subdirectories
+func (s *search) work() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for len(s.queue) == 0 && s.pending > 0 {
+			s.cond.Wait()
+		}
+		if s.pending == 0 {
+			return
+		}
+		// Last in, first out, to keep the queue short
+		d := s.queue[len(s.queue)-1]
+		s.queue = s.queue[:len(s.queue)-1]
+		skip := s.err != nil
+		s.mu.Unlock()
+
+		var selections []Selection
+		var subdirs []dirToWalk
+		var err error
+		if !skip {
+			selections, subdirs, err = s.walkDir(d)
+		}
+
+		s.mu.Lock()
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+		s.selections = append(s.selections, selections...)
+		s.queue = append(s.queue, subdirs...)
+		s.pending += len(subdirs) - 1
+		s.cond.Broadcast()
+	}
+}
+
+// Read the directory d, and return the selections of its entries, and its
+// subdirectories to walk
+func (s *search) walkDir(d dirToWalk) ([]Selection, []dirToWalk, error) {
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	ignored, err := d.ignored.WithDir(d.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var selections []Selection
+	var subdirs []dirToWalk
+	for _, info := range entries {
+		path := filepath.Join(d.dir, info.Name())
+		rel := info.Name()
+		if d.relativePath != "." {
+			rel = d.relativePath + "/" + info.Name()
+		}
+		selection, descend := s.decide(path, rel, info.IsDir(), ignored)
+		if selection != nil {
+			selections = append(selections, *selection)
+		}
+		if descend {
+			subdirs = append(subdirs, dirToWalk{path, rel, ignored})
+		}
+	}
+	return selections, subdirs, nil
+}
+
+// Decide on the file or directory at path, and at relativePath from the
+// root. Return the selection to report if any, and whether it's a directory
+// to walk.
+func (s *search) decide(filePath, relativePath string, isDir bool, ignored *ignore.Matcher) (*Selection, bool) {
+	name := path.Base(relativePath)
+	selection := &Selection{Path: relativePath, Dir: isDir}
+	if !selection.Dir {
+		df := depfile.Find(filePath)
+		if df == nil {
+			return nil, false
+		}
+		selection.Type = df.Name
+	}
+	skip := func(source, rule string) (*Selection, bool) {
+		selection.Source, selection.Rule = source, rule
+		return selection, false
+	}
+
+	// Excluded directories are skipped at any level
+	if selection.Dir && s.excludedDirs[name] {
+		return skip("excluded_dirs", name)
+	}
+	if selection.Dir && s.otherProjects[relativePath] {
+		return skip("projects", relativePath)
+	}
+	if isIgnored, rule := ignored.Explain(filePath, selection.Dir); isIgnored {
+		source := strings.SplitN(rule, ": ", 2)
+		return skip(source[0], source[1])
+	}
+	for i, pattern := range s.ignoredPaths {
+		// Matching the name is the old behavior, kept in case users rely on it
+		if matched, _ := filepath.Match(pattern, name); matched || s.ignoredGlobs[i].Match(relativePath) {
+			return skip("ignored_paths", pattern)
+		}
+	}
+	if selection.Dir {
+		return nil, true
+	}
+
+	selection.Selected = true
+	if len(s.includeGlobs) > 0 {
+		selection.Selected, selection.Source = false, "include_paths"
+		for i, glob := range s.includeGlobs {
+			if matchIncludePath(glob, config.IncludePaths[i], relativePath) {
+				selection.Selected, selection.Rule = true, config.IncludePaths[i]
+				break
+			}
+		}
+	}
+	return selection, false
+}
+
+// Call visit with the selections, in the order of filepath.Walk
+func (s *search) report(visit func(s Selection)) {
+	sort.Slice(s.selections, func(i, j int) bool {
+		return walkOrder(s.selections[i].Path, s.selections[j].Path)
+	})
+	for _, selection := range s.selections {
+		visit(selection)
+	}
+}
+
+// Tell whether the relative path a comes before b in the order of
+// filepath.Walk: the entries of a directory are sorted by name, and the
+// subdirectories are walked before the next entries.
+func walkOrder(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// Tell whether glob, the compiled pattern of include_paths, matches the
+// file at relativePath, or one of its directories. Patterns ending with a
+// slash only match directories.
+func matchIncludePath(glob *ignore.Glob, pattern, relativePath string) bool {
+	if !strings.HasSuffix(pattern, "/") && glob.Match(relativePath) {
+		return true
+	}
+	for dir := path.Dir(relativePath); dir != "."; dir = path.Dir(dir) {
+		if glob.Match(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Print the dependency files of project p found locally, whether they're
+// selected to be sent, and the rule deciding it. The directories skipped
+// are listed too.
+func ListLocalDependencyFiles(p config.SubProject) error {
+	dir := projectDir(p)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Path", "Type", "Selected", "Rule"})
+	count := 0
+	err := searchDependencyFiles(dir, p, func(s Selection) {
+		path, selected := s.Path, "no"
+		if s.Dir {
+			path += "/"
+		}
+		if s.Selected {
+			selected = "yes"
+			count++
+		}
+		table.Append([]string{path, s.Type, selected, s.Reason()})
+	})
+	if err != nil {
+		return err
+	}
+	table.Render()
+	fmt.Printf("%d dependency files selected\n", count)
+	return nil
+}
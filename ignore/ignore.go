@@ -0,0 +1,319 @@
+// Package ignore matches paths against gitignore patterns, as found in
+// .gitignore, .git/info/exclude and .gemnasiumignore files.
+// See https://git-scm.com/docs/gitignore for the syntax.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Files holding patterns, read in this order in each directory, so that
+// .gemnasiumignore can negate the patterns of .gitignore
+var FileNames = []string{".gitignore", ".gemnasiumignore"}
+
+// Patterns of a directory tree, the last matching one deciding whether a
+// path is ignored
+type Matcher struct {
+	root     string
+	patterns []pattern
+}
+
+type pattern struct {
+	base    string // Directory of the file holding the pattern, relative to root
+	source  string // File and line of the pattern, ex: apps/.gitignore:3
+	text    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Return a matcher for the paths of root, with no patterns
+func New(root string) *Matcher {
+	return &Matcher{root: root}
+}
+
+// Return a matcher with the patterns applying to dir: the ones of
+// .git/info/exclude and of the ignore files of the directories from the root
+// of the git repository holding dir down to the parent of dir. The ignore
+// files of dir and of its subdirectories are to be added with AddDir while
+// walking it. Outside of a git repository, only these ones apply.
+func ForTree(dir string) (*Matcher, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	root := RepositoryRoot(dir)
+	if root == "" {
+		root = dir
+	}
+	m := New(root)
+	if root == dir {
+		return m, m.AddFile(filepath.Join(root, ".git", "info", "exclude"))
+	}
+	var parents []string
+	for parent := filepath.Dir(dir); ; parent = filepath.Dir(parent) {
+		parents = append([]string{parent}, parents...)
+		if parent == root {
+			break
+		}
+	}
+	if err := m.AddFile(filepath.Join(root, ".git", "info", "exclude")); err != nil {
+		return nil, err
+	}
+	for _, parent := range parents {
+		if err := m.AddDir(parent); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Return the root of the git repository holding dir, an absolute path: the
+// first of dir and its parents holding .git. Return "" outside of a git
+// repository.
+func RepositoryRoot(dir string) string {
+	for current := dir; ; {
+		// .git is a file in worktrees and submodules
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return ""
+		}
+		current = parent
+	}
+}
+
+// Return a matcher with the patterns of m, and the ones of the ignore files
+// of dir. m is left unchanged, so that the directories of a tree can be
+// walked concurrently, each one with its own matcher.
+func (m *Matcher) WithDir(dir string) (*Matcher, error) {
+	n := len(m.patterns)
+	child := &Matcher{root: m.root, patterns: m.patterns[:n:n]}
+	return child, child.AddDir(dir)
+}
+
+// Add the patterns of the ignore files of dir, a directory of the tree
+func (m *Matcher) AddDir(dir string) error {
+	for _, name := range FileNames {
+		if err := m.AddFile(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add the patterns of the file at path, which apply to the paths of its
+// directory. A missing file is ignored.
+func (m *Matcher) AddFile(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	base, err := m.rel(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	// .git/info/exclude applies to the whole tree
+	if filepath.Base(path) == "exclude" && strings.HasSuffix(base, ".git/info") {
+		base = strings.TrimSuffix(strings.TrimSuffix(base, ".git/info"), "/")
+	}
+	source, err := m.rel(path)
+	if err != nil {
+		return err
+	}
+	return m.addPatterns(base, source, f)
+}
+
+// Add the patterns of the ignore file at name, relative to root and with
+// slashes, read from r instead of the file system (ex: from a git revision)
+func (m *Matcher) AddReader(name string, r io.Reader) error {
+	return m.addPatterns(path.Dir(name), name, r)
+}
+
+// Add the patterns read from r, one per line, applying to the paths of
+// base, a directory relative to root ("" for root itself)
+func (m *Matcher) AddPatterns(base string, r io.Reader) error {
+	return m.addPatterns(base, "", r)
+}
+
+func (m *Matcher) addPatterns(base, source string, r io.Reader) error {
+	if base == "." {
+		base = ""
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if p, ok := parse(scanner.Text()); ok {
+			p.base = base
+			p.source = fmt.Sprintf("%s:%d", source, line)
+			p.text = strings.TrimSpace(scanner.Text())
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return scanner.Err()
+}
+
+// Tell whether path, in the tree of root, is ignored. A path can't be
+// included again if its parent directory is ignored: the caller is expected
+// to skip the ignored directories.
+func (m *Matcher) Match(path string, isDir bool) bool {
+	ignored, _ := m.Explain(path, isDir)
+	return ignored
+}
+
+// Tell whether path is ignored like Match, and return the pattern deciding
+// it, as "file:line: pattern", or "" if no pattern matches path
+func (m *Matcher) Explain(path string, isDir bool) (bool, string) {
+	rel, err := m.rel(path)
+	if err != nil {
+		return false, ""
+	}
+	ignored, rule := false, ""
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if p.base != "" {
+			if !strings.HasPrefix(rel, p.base+"/") {
+				continue
+			}
+			sub = strings.TrimPrefix(rel, p.base+"/")
+		}
+		if p.re.MatchString(sub) {
+			ignored, rule = !p.negate, p.source+": "+p.text
+		}
+	}
+	return ignored, rule
+}
+
+// Tell whether path, relative and with slashes, matches glob, where * and ?
+// don't match slashes and ** matches any number of directories (ex:
+// spec/**/Gemfile). An invalid glob matches nothing.
+func MatchGlob(glob, path string) bool {
+	return NewGlob(glob).Match(path)
+}
+
+// A compiled glob, see MatchGlob
+type Glob struct {
+	re *regexp.Regexp
+}
+
+func NewGlob(glob string) *Glob {
+	re, err := regexp.Compile("^" + translate(strings.TrimPrefix(glob, "/")) + "$")
+	if err != nil {
+		return &Glob{}
+	}
+	return &Glob{re: re}
+}
+
+// Tell whether path, relative and with slashes, matches the glob
+func (g *Glob) Match(path string) bool {
+	return g.re != nil && g.re.MatchString(path)
+}
+
+// Return path relative to root, with slashes
+func (m *Matcher) rel(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		var err error
+		if path, err = filepath.Abs(path); err != nil {
+			return "", err
+		}
+	}
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Parse a line of an ignore file, and return false if there's no pattern
+func parse(line string) (pattern, bool) {
+	var p pattern
+	// Trailing spaces are ignored, unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+	// Patterns without a slash match at any level, the other ones are
+	// relative to their base
+	prefix := "(?:.*/)?"
+	if strings.Contains(line, "/") {
+		prefix = ""
+		line = strings.TrimPrefix(line, "/")
+	}
+	re, err := regexp.Compile("^" + prefix + translate(line) + "$")
+	if err != nil {
+		// Invalid patterns (ex: [z-a]) are ignored, like git does
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+// Translate the glob pattern to a regexp
+func translate(glob string) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			// Any number of directories, none included
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && i > 0 && glob[i-1] == '/':
+			// Everything inside
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
@@ -0,0 +1,168 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"Gemfile.lock", "Gemfile.lock", false, true},
+		{"Gemfile.lock", "apps/rails/Gemfile.lock", false, true},
+		{"*.lock", "apps/yarn.lock", false, true},
+		{"*.lock", "apps/yarn.lock/package.json", false, false},
+		{"# comment", "# comment", false, false},
+		{`\#file`, "#file", false, true},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "apps/build", true, true},
+		{"/build", "build", false, true},
+		{"/build", "apps/build", false, false},
+		{"test/fixtures", "test/fixtures", true, true},
+		{"test/fixtures", "apps/test/fixtures", true, false},
+		{"**/fixtures", "apps/test/fixtures", true, true},
+		{"**/fixtures", "fixtures", true, true},
+		{"test/**/Gemfile", "test/Gemfile", false, true},
+		{"test/**/Gemfile", "test/a/b/Gemfile", false, true},
+		{"test/**", "test/a/b/Gemfile", false, true},
+		{"test/**", "test", true, false},
+		{"Gemfile.?ock", "Gemfile.lock", false, true},
+		{"[Gg]emfile", "gemfile", false, true},
+		{"[!G]emfile", "Gemfile", false, false},
+		{"*.lock   ", "yarn.lock", false, true},
+		{`a\ `, "a ", false, true},
+	}
+	for _, tt := range tests {
+		m := New("/src")
+		m.AddPatterns("", strings.NewReader(tt.pattern))
+		if got := m.Match(filepath.Join("/src", filepath.FromSlash(tt.path)), tt.isDir); got != tt.ignored {
+			t.Errorf("Pattern %q on %s: expected ignored to be %v, got %v", tt.pattern, tt.path, tt.ignored, got)
+		}
+	}
+}
+
+func TestNegationAndBase(t *testing.T) {
+	m := New("/src")
+	m.AddPatterns("", strings.NewReader("*.lock\n!yarn.lock\n"))
+	m.AddPatterns("apps", strings.NewReader("/yarn.lock\n"))
+	tests := map[string]bool{
+		"Gemfile.lock":      true,
+		"yarn.lock":         false,
+		"lib/yarn.lock":     false,
+		"apps/yarn.lock":    true,
+		"apps/js/yarn.lock": false,
+	}
+	for path, expected := range tests {
+		if got := m.Match(filepath.Join("/src", filepath.FromSlash(path)), false); got != expected {
+			t.Errorf("%s: expected ignored to be %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestForTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium-ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		".git/info/exclude": "*.bak\n",
+		".gitignore":        "*.lock\n",
+		"apps/.gitignore":   "!Gemfile.lock\n",
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.MkdirAll(filepath.Join(dir, "apps", "rails"), 0755)
+
+	// The ignore files of the parents apply, up to the root of the repository
+	m, err := ForTree(filepath.Join(dir, "apps", "rails"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"apps/rails/Gemfile.lock": false,
+		"apps/rails/yarn.lock":    true,
+		"apps/rails/Gemfile.bak":  true,
+	}
+	for path, expected := range tests {
+		if got := m.Match(filepath.Join(dir, filepath.FromSlash(path)), false); got != expected {
+			t.Errorf("%s: expected ignored to be %v, got %v", path, expected, got)
+		}
+	}
+}
+
+func TestRepositoryRoot(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	worktree := filepath.Join(repo, "worktree")
+	os.MkdirAll(filepath.Join(repo, ".git"), 0755)
+	os.MkdirAll(filepath.Join(worktree, "apps"), 0755)
+	// .git is a file in worktrees and submodules
+	ioutil.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: ../.git/worktrees/worktree\n"), 0644)
+
+	tests := map[string]string{
+		repo:                            repo,
+		filepath.Join(worktree, "apps"): worktree,
+		dir:                             "",
+	}
+	for path, expected := range tests {
+		if root := RepositoryRoot(path); root != expected {
+			t.Errorf("%s: expected root %q, got %q", path, expected, root)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		matched bool
+	}{
+		{"spec/**/Gemfile", "spec/Gemfile", true},
+		{"spec/**/Gemfile", "spec/fixtures/app/Gemfile", true},
+		{"spec/**/Gemfile", "app/spec/Gemfile", false},
+		{"**/Gemfile", "Gemfile", true},
+		{"services/*", "services/api", true},
+		{"services/*", "services/api/package.json", false},
+		{"services/**", "services/api/package.json", true},
+		{"/vendor", "vendor", true},
+		{"[", "[", true},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.glob, tt.path); got != tt.matched {
+			t.Errorf("Glob %q on %s: expected %v, got %v", tt.glob, tt.path, tt.matched, got)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemnasium-ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("# Build outputs\nbuild/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := New(dir)
+	if err := m.AddDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	ignored, rule := m.Explain(filepath.Join(dir, "build"), true)
+	if !ignored || rule != ".gitignore:2: build/" {
+		t.Errorf("Expected build/ to be ignored by .gitignore:2, got %v, %q", ignored, rule)
+	}
+}
@@ -1,6 +1,7 @@
 package liveeval
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -17,25 +18,28 @@ import (
 // the same language (ie: package.json + Gemfile + Gemfile.lock) LiveEvaluation
 // will return 2 stases (color for Runtime / Dev.) and the list of deps with
 // their color.
-func LiveEvaluation(files []string) error {
+// Without files, the dependency files of project p are evaluated.
+// The evaluation is aborted as soon as ctx is done.
+func LiveEvaluation(ctx context.Context, p config.SubProject, files []string) error {
 
-	dfiles, err := dependency.LookupDependencyFiles(files)
+	dfiles, err := dependency.LookupDependencyFiles(p, files)
 	if err != nil {
 		return err
 	}
 
 	requestDeps := map[string][]*api.DependencyFile{"dependency_files": dfiles}
 
-	jsonResp, err := api.APIImpl.LiveEvalStart(requestDeps)
+	jsonResp, err := api.APIImpl.LiveEvalStart(ctx, requestDeps)
 	if err != nil {
 		return err
 	}
 
 	// Wait until job is done
 	var response api.LiveEvalResponse
+	var body []byte
 	var iter int // used to display the little dots for each loop bellow
 	for {
-		response, body, err := api.APIImpl.LiveEvalGetResponse(jsonResp["job_id"])
+		response, body, err = api.APIImpl.LiveEvalGetResponse(ctx, jsonResp["job_id"])
 		if err != nil {
 			return err
 		}
@@ -52,7 +56,12 @@ func LiveEvaluation(files []string) error {
 			break
 		}
 		// Wait 1s before trying again
-		time.Sleep(time.Second * 1)
+		select {
+		case <-time.After(time.Second * 1):
+		case <-ctx.Done():
+			fmt.Println()
+			return ctx.Err()
+		}
 	}
 
 	color.Println(fmt.Sprintf("\n\n%-12.12s %s", "Run. Status", utils.StatusDots(response.Result.RuntimeStatus)))
@@ -12,6 +12,6 @@ func main() {
 	err := app.Run(os.Args)
 	if err != nil {
 		color.Printf("@{r!}%s", err.Error())
-		os.Exit(1)
+		os.Exit(commands.ExitCode(err))
 	}
 }
@@ -1,27 +1,35 @@
 package project
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/gemnasium/toolbelt/config"
 	"github.com/gemnasium/toolbelt/utils"
+	"github.com/heroku/hk/term"
 	"github.com/olekukonko/tablewriter"
 	"github.com/wsxiaoys/terminal/color"
-	"gopkg.in/yaml.v1"
 	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/team"
 	"bufio"
 )
 
+// Lambda to be overriden in tests
+var isTerminal = func() bool {
+	return term.IsTerminal(os.Stdin)
+}
+
 // List projects on gemnasium
 // TODO: Add a flag to display unmonitored projects too
-func ListProjects(privateProjectsOnly bool) (err error) {
+func ListProjects(ctx context.Context, privateProjectsOnly bool) (err error) {
 	var projects map[string][]api.Project
-	projects, err = api.APIImpl.ProjectList(privateProjectsOnly)
+	projects, err = api.APIImpl.ProjectList(ctx, privateProjectsOnly)
 	if err != nil {
 		return err
 	}
@@ -34,7 +42,7 @@ func ListProjects(privateProjectsOnly bool) (err error) {
 		table := tablewriter.NewWriter(os.Stdout)
 		table.SetHeader([]string{"Name", "Slug", "Private"})
 		for _, project := range projects[owner] {
-			if !project.Monitored || (!project.Private && privateProjectsOnly) {
+			if (project.Monitored != nil && !*project.Monitored) || (!project.Private && privateProjectsOnly) {
 				continue
 			}
 
@@ -55,8 +63,8 @@ func ListProjects(privateProjectsOnly bool) (err error) {
 
 // Display project details
 // http://docs.gemnasium.apiary.io/#get-%2Fprojects%2F%7Bslug%7D
-func ProjectShow(p *api.Project) error {
-	err := ProjectFetch(p)
+func ProjectShow(ctx context.Context, p *api.Project) error {
+	err := ProjectFetch(ctx, p)
 	if err != nil {
 		return err
 	}
@@ -73,9 +81,21 @@ func ProjectShow(p *api.Project) error {
 	table.Append([]string{"Description", p.Description})
 	table.Append([]string{"Origin", p.Origin})
 	table.Append([]string{"Private", strconv.FormatBool(p.Private)})
-	table.Append([]string{"Monitored", strconv.FormatBool(p.Monitored)})
-	if !p.Monitored {
-		table.Append([]string{"Unmonitored reason", p.UnmonitoredReason})
+	if p.Team != nil {
+		table.Append([]string{"Team", p.Team.Slug})
+	}
+	if p.Monitored != nil {
+		table.Append([]string{"Monitored", strconv.FormatBool(*p.Monitored)})
+		if !*p.Monitored {
+			table.Append([]string{"Unmonitored reason", p.UnmonitoredReason})
+		}
+	}
+	if p.CommitSHA != "" {
+		commit := p.CommitSHA
+		if p.Branch != "" {
+			commit += " (" + p.Branch + ")"
+		}
+		table.Append([]string{"Latest commit", commit})
 	}
 
 	table.Render()
@@ -84,7 +104,7 @@ func ProjectShow(p *api.Project) error {
 
 // Update project details
 // http://docs.gemnasium.apiary.io/#patch-%2Fprojects%2F%7Bslug%7D
-func ProjectUpdate(p *api.Project, name, desc *string, monitored *bool) error {
+func ProjectUpdate(ctx context.Context, p *api.Project, name, desc *string, monitored *bool) error {
 	if name == nil && desc == nil && monitored == nil {
 		return errors.New("Please specify at least one thing to update (name, desc, or monitored")
 	}
@@ -99,7 +119,7 @@ func ProjectUpdate(p *api.Project, name, desc *string, monitored *bool) error {
 	if monitored != nil {
 		update["monitored"] = *monitored
 	}
-	err := api.APIImpl.ProjectUpdate(p, update)
+	err := api.APIImpl.ProjectUpdate(ctx, p, update)
 	if err != nil {
 		return err
 	}
@@ -111,8 +131,10 @@ func ProjectUpdate(p *api.Project, name, desc *string, monitored *bool) error {
 // Create a new project on gemnasium.
 // The first arg is used as the project name.
 // If no arg is provided, the user will be prompted to enter a project name.
+// With API v2, the project is created in the team with the given slug, or
+// in a team picked by the user (see team.Select).
 // http://docs.gemnasium.apiary.io/#post-%2Fprojects
-func CreateProject(projectName string, r io.Reader) error {
+func CreateProject(ctx context.Context, projectName, teamSlug string, r io.Reader) error {
 	project := &api.Project{Name: projectName}
 	if project.Name == "" {
 		fmt.Printf("Enter project name: ")
@@ -127,7 +149,13 @@ func CreateProject(projectName string, r io.Reader) error {
 	project.Description = scanner.Text()
 	fmt.Println("") // quickfix for goconvey
 
-	jsonResp, err := api.APIImpl.ProjectCreate(project)
+	t, err := team.Select(ctx, teamSlug, scanner)
+	if err != nil {
+		return err
+	}
+	project.Team = t
+
+	jsonResp, err := api.APIImpl.ProjectCreate(ctx, project)
 	if err != nil {
 		return err
 	}
@@ -137,35 +165,131 @@ func CreateProject(projectName string, r io.Reader) error {
 	return nil
 }
 
-// Create a project config gile (.gemnasium.yml)
-func ProjectConfigure(p *api.Project, slug string, r io.Reader, w io.Writer) error {
-	if slug == "" {
-		fmt.Printf("Enter project slug: ")
-		_, err := fmt.Scanln(&slug)
+// Configure the project config file (.gemnasium.yml) for the project slug,
+// or for the project picked by the user if empty. The user may also add
+// dirs, the directories holding dependency files, to ignored_paths, which
+// needs a terminal. The choices are read from r. The other settings of the
+// file, and its comments, are kept.
+func ProjectConfigure(ctx context.Context, slug string, dirs []string, r io.Reader) error {
+	if len(dirs) > 0 && !isTerminal() {
+		return errors.New("--scan needs a terminal, to choose the directories to ignore")
+	}
+	scanner := bufio.NewScanner(r)
+	slug, err := selectProject(ctx, slug, scanner)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{"project_slug": slug}
+	if len(dirs) > 0 {
+		ignored, err := selectIgnoredPaths(dirs, scanner)
 		if err != nil {
 			return err
 		}
+		if len(ignored) > 0 {
+			s, err := config.ProjectSettings()
+			if err != nil {
+				return err
+			}
+			if s.IgnoredPaths != nil {
+				ignored = append(*s.IgnoredPaths, ignored...)
+			}
+			values["ignored_paths"] = ignored
+		}
 	}
 
-	// We just create a file with project_config for now.
-	projectConfig := &map[string]string{"project_slug": slug}
-	body, err := yaml.Marshal(&projectConfig)
-	if err != nil {
-		log.Fatalf("error: %v", err)
-	}
-	// write content to the file
-	_, err = w.Write(body)
-	if err != nil {
+	_, statErr := os.Stat(config.ProjectConfigFile)
+	if err := config.WriteProjectSettings(values); err != nil {
 		return err
 	}
-	color.Println("@gYour .gemnasium.yml was created!")
+	if os.IsNotExist(statErr) {
+		color.Printf("@gYour %s was created!\n", config.ProjectConfigFile)
+	} else {
+		color.Printf("@gYour %s was updated!\n", config.ProjectConfigFile)
+	}
 	return nil
 }
 
+// Return the slug of the project to configure: slug if not empty, or the
+// project picked by the user among their projects (reading the choice from
+// scanner) when attached to a terminal, or else the project configured.
+func selectProject(ctx context.Context, slug string, scanner *bufio.Scanner) (string, error) {
+	if slug != "" {
+		return slug, nil
+	}
+	if !isTerminal() {
+		if config.ProjectSlug != "" {
+			return config.ProjectSlug, nil
+		}
+		return "", errors.New("Please give the slug of the project: gemnasium configure [project_slug]")
+	}
+	projectsByOwner, err := api.APIImpl.ProjectList(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	// The projects of the user first, then the shared ones by owner
+	var owners []string
+	for owner := range projectsByOwner {
+		if owner != "owned" {
+			owners = append(owners, owner)
+		}
+	}
+	sort.Strings(owners)
+	var projects []api.Project
+	for _, owner := range append([]string{"owned"}, owners...) {
+		for _, p := range projectsByOwner[owner] {
+			if p.Monitored == nil || *p.Monitored {
+				projects = append(projects, p)
+			}
+		}
+	}
+	if len(projects) == 0 {
+		return "", errors.New("No project found, please create one with: gemnasium projects create")
+	}
+
+	fmt.Println("Choose the project of this directory:")
+	choice := 1
+	for i, p := range projects {
+		fmt.Printf("  %d) %s (%s)\n", i+1, p.Name, p.Slug)
+		if p.Slug == config.ProjectSlug {
+			choice = i + 1
+		}
+	}
+	fmt.Printf("Enter a number [%d]: ", choice)
+	scanner.Scan()
+	if text := strings.TrimSpace(scanner.Text()); text != "" {
+		i, err := strconv.Atoi(text)
+		if err != nil || i < 1 || i > len(projects) {
+			return "", fmt.Errorf("Invalid project number: %s", text)
+		}
+		choice = i
+	}
+	return projects[choice-1].Slug, nil
+}
+
+// Return the directories among dirs picked by the user to be ignored,
+// reading the choice from scanner
+func selectIgnoredPaths(dirs []string, scanner *bufio.Scanner) ([]string, error) {
+	fmt.Println("Dependency files were found in these directories:")
+	for i, dir := range dirs {
+		fmt.Printf("  %d) %s\n", i+1, dir)
+	}
+	fmt.Printf("Enter the numbers of the ones to ignore, separated with spaces [none]: ")
+	scanner.Scan()
+	var ignored []string
+	for _, text := range strings.Fields(scanner.Text()) {
+		i, err := strconv.Atoi(text)
+		if err != nil || i < 1 || i > len(dirs) {
+			return nil, fmt.Errorf("Invalid directory number: %s", text)
+		}
+		ignored = append(ignored, dirs[i-1])
+	}
+	return ignored, nil
+}
+
 // Start project synchronization
 // http://docs.gemnasium.apiary.io/#post-%2Fprojects%2F%7Bslug%7D%2Fsync
-func ProjectSync(p *api.Project) (err error) {
-	err = api.APIImpl.ProjectSync(p)
+func ProjectSync(ctx context.Context, p *api.Project) (err error) {
+	err = api.APIImpl.ProjectSync(ctx, p)
 	if err != nil {
 		return err
 	}
@@ -174,26 +298,30 @@ func ProjectSync(p *api.Project) (err error) {
 	return nil
 }
 
-func ProjectFetch(p *api.Project) (err error) {
-	err = api.APIImpl.ProjectFetch(p)
+func ProjectFetch(ctx context.Context, p *api.Project) (err error) {
+	err = api.APIImpl.ProjectFetch(ctx, p)
 	return err
 }
 
-func ProjectDependencies(p *api.Project) (deps []api.Dependency, err error) {
-	deps, err = api.APIImpl.ProjectGetDependencies(p)
+func ProjectDependencies(ctx context.Context, p *api.Project) (deps []api.Dependency, err error) {
+	deps, err = api.APIImpl.ProjectGetDependencies(ctx, p)
 	return deps, err
 }
 
 // Fetch and return the dependency files ([]DependecyFile) for the current project
-func ProjectDependencyFiles(p *api.Project) (dfiles []api.DependencyFile, err error) {
-	dfiles, err = api.APIImpl.ProjectGetDependencyFiles(p)
+func ProjectDependencyFiles(ctx context.Context, p *api.Project) (dfiles []api.DependencyFile, err error) {
+	dfiles, err = api.APIImpl.ProjectGetDependencyFiles(ctx, p)
 	return dfiles, err
 }
 
 // Return a new Project with Slug set.
-// The slugs in param are tried in order.
+// The slugs in param are tried in order, and then the project of the
+// current directory in a monorepo.
 func GetProject(slugs ...string) (*api.Project, error) {
 	slug := config.ProjectSlug
+	if current, err := config.CurrentSubProject(); err == nil && current != nil {
+		slug = current.Slug
+	}
 	for _, s := range slugs {
 		if s != "" {
 			slug = s
@@ -204,3 +332,76 @@ func GetProject(slugs ...string) (*api.Project, error) {
 	}
 	return &api.Project{Slug: slug}, nil
 }
+
+// Return the projects to work on. slug, when given, selects a single
+// project; all selects every project of .gemnasium.yml, including the one
+// of project_slug. Otherwise it's the project of the current directory in a
+// monorepo, or else the one of project_slug.
+func GetProjects(slug string, all bool) ([]config.SubProject, error) {
+	root := config.SubProject{Path: ".", Slug: config.ProjectSlug}
+	if slug != "" {
+		if all {
+			return nil, errors.New("A project slug can't be given with --all")
+		}
+		for _, p := range config.Projects {
+			if p.Slug == slug {
+				return []config.SubProject{p}, nil
+			}
+		}
+		return []config.SubProject{{Path: ".", Slug: slug}}, nil
+	}
+	if all {
+		if len(config.Projects) == 0 {
+			return nil, fmt.Errorf("--all needs a projects section in %s", config.ProjectConfigFile)
+		}
+		projects := config.Projects
+		if root.Slug != "" {
+			projects = append([]config.SubProject{root}, projects...)
+		}
+		return projects, nil
+	}
+	current, err := config.CurrentSubProject()
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return []config.SubProject{*current}, nil
+	}
+	if root.Slug == "" && len(config.Projects) > 0 {
+		var names []string
+		for _, p := range config.Projects {
+			names = append(names, p.Path)
+		}
+		return nil, fmt.Errorf("Several projects are set in %s (%s), please use --all or run the command in the directory of one of them", config.ProjectConfigFile, strings.Join(names, ", "))
+	}
+	if root.Slug == "" {
+		return nil, errors.New("[project slug] can't be empty")
+	}
+	return []config.SubProject{root}, nil
+}
+
+// Run f for each project, printing a header before each one when there
+// are several. All the projects are run even if some fail.
+func ForEach(projects []config.SubProject, f func(p config.SubProject) error) error {
+	if len(projects) == 1 {
+		return f(projects[0])
+	}
+	var failed []string
+	var lastErr error
+	for _, p := range projects {
+		color.Printf("@{!}==> %s (%s)\n", p.Path, p.Slug)
+		if err := f(p); err != nil {
+			color.Fprintf(os.Stderr, "@{r!}%s: %s\n", p.Path, err)
+			failed = append(failed, p.Path)
+			lastErr = err
+		}
+		fmt.Println()
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return lastErr
+	}
+	return fmt.Errorf("%d projects failed: %s", len(failed), strings.Join(failed, ", "))
+}
@@ -1,7 +1,9 @@
 package project
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,13 +12,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/wsxiaoys/terminal/color"
 	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+	"github.com/gemnasium/toolbelt/config"
+	"github.com/gemnasium/toolbelt/config/configtest"
 )
 
+func TestMain(m *testing.M) {
+	os.Exit(configtest.Run(m))
+}
+
 func CreateProjectTestServer(t *testing.T, APIKey string) *httptest.Server {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -67,7 +77,7 @@ func TestCreateProject(t *testing.T) {
 
 	api.APIImpl = api.NewAPIv1(ts.URL, apiKey)
 	r := strings.NewReader("Project description\n")
-	err := CreateProject("test_project", r)
+	err := CreateProject(context.Background(), "test_project", "", r)
 	if err != nil {
 		t.Error(err)
 	}
@@ -82,24 +92,136 @@ func TestCreateProjectWithWrongToken(t *testing.T) {
 
 	api.APIImpl = api.NewAPIv1(ts.URL, "invalid key")
 	r := strings.NewReader("Project description\n")
-	err := CreateProject("test_project", r)
+	err := CreateProject(context.Background(), "test_project", "", r)
 	if err.Error() != "Error: Invalid API Key (status=401)\n" {
 		t.Error(err)
 	}
 }
 
+// Use a temp project config file holding data, and return its path
+func withProjectConfigFile(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "gemnasium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgFile := config.ProjectConfigFile
+	config.ProjectConfigFile = filepath.Join(dir, config.CONFIG_FILE_PATH)
+	if data != "" {
+		if err := ioutil.WriteFile(config.ProjectConfigFile, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		config.ProjectConfigFile = orgFile
+		os.RemoveAll(dir)
+	})
+	return config.ProjectConfigFile
+}
+
 func TestConfigureProject(t *testing.T) {
-	// set first param
-	tmp, err := ioutil.TempFile("", "gemnasium")
+	path := withProjectConfigFile(t, "")
+	err := ProjectConfigure(context.Background(), "my_slug", nil, os.Stdin)
 	if err != nil {
 		t.Error(err)
 	}
-	defer tmp.Close()
-	defer os.Remove(tmp.Name())
-	p := &api.Project{Slug: "blah"}
-	err = ProjectConfigure(p,"my_slug", os.Stdin, tmp)
+	if dat, _ := ioutil.ReadFile(path); string(dat) != "project_slug: my_slug\n" {
+		t.Errorf("Unexpected config file:\n%s", dat)
+	}
+}
+
+func TestConfigureProjectKeepsSettings(t *testing.T) {
+	path := withProjectConfigFile(t, `# Settings of the project
+api_endpoint: https://gemnasium.example.com/api/v2
+project_slug: old_slug # set by configure
+ignored_paths:
+  - vendor/
+`)
+	orgIsTerminal := isTerminal
+	isTerminal = func() bool { return true }
+	defer func() { isTerminal = orgIsTerminal }()
+
+	// Ignore the 2nd directory
+	dirs := []string{"examples/app", "test/fixtures"}
+	err := ProjectConfigure(context.Background(), "my_slug", dirs, strings.NewReader("2\n"))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	expected := `# Settings of the project
+api_endpoint: https://gemnasium.example.com/api/v2
+project_slug: my_slug # set by configure
+ignored_paths:
+- vendor/
+- test/fixtures
+`
+	if dat, _ := ioutil.ReadFile(path); string(dat) != expected {
+		t.Errorf("Expected config file:\n%s\ngot:\n%s", expected, dat)
+	}
+}
+
+func TestConfigureProjectScanNeedsTerminal(t *testing.T) {
+	path := withProjectConfigFile(t, "project_slug: old_slug\n")
+	orgIsTerminal := isTerminal
+	isTerminal = func() bool { return false }
+	defer func() { isTerminal = orgIsTerminal }()
+
+	err := ProjectConfigure(context.Background(), "my_slug", []string{"examples/app"}, strings.NewReader(""))
+	if err == nil || !strings.Contains(err.Error(), "--scan needs a terminal") {
+		t.Errorf("Expected --scan to need a terminal, got %v", err)
+	}
+	if dat, _ := ioutil.ReadFile(path); string(dat) != "project_slug: old_slug\n" {
+		t.Errorf("The config file should be left as is, got:\n%s", dat)
+	}
+}
+
+func TestSelectProject(t *testing.T) {
+	srv := apitest.NewServer(1)
+	defer srv.Close()
+	srv.AddProject(&apitest.Project{Project: api.Project{Slug: "batmobile", Name: "Batmobile"}})
+	srv.AddProject(&apitest.Project{Project: api.Project{Slug: "batcave", Name: "Batcave"}, Owner: "Alfred"})
+	srv.AddProject(&apitest.Project{Project: api.Project{Slug: "batarang", Name: "Batarang", Monitored: new(bool)}})
+	api.APIImpl = api.NewAPIv1(srv.URL, srv.APIKey)
+
+	orgIsTerminal := isTerminal
+	defer func() { isTerminal = orgIsTerminal }()
+	orgSlug := config.ProjectSlug
+	defer func() { config.ProjectSlug = orgSlug }()
+
+	tests := []struct {
+		name     string
+		slug     string
+		current  string
+		terminal bool
+		input    string
+		expected string
+		err      string
+	}{
+		{name: "slug", slug: "batarang", expected: "batarang"},
+		// The projects of the user come first
+		{name: "picked", terminal: true, input: "2\n", expected: "batcave"},
+		{name: "default choice", terminal: true, input: "\n", expected: "batmobile"},
+		{name: "current project", current: "batcave", terminal: true, input: "\n", expected: "batcave"},
+		{name: "invalid choice", terminal: true, input: "3\n", err: "Invalid project number: 3"},
+		{name: "not a terminal, project configured", current: "batcave", expected: "batcave"},
+		{name: "not a terminal", err: "Please give the slug of the project: gemnasium configure [project_slug]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isTerminal = func() bool { return tt.terminal }
+			config.ProjectSlug = tt.current
+			slug, err := selectProject(context.Background(), tt.slug, bufio.NewScanner(strings.NewReader(tt.input)))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slug != tt.expected {
+				t.Errorf("Expected project %s, got %s", tt.expected, slug)
+			}
+		})
 	}
 }
 
@@ -120,7 +242,7 @@ func TestSyncProject(t *testing.T) {
 	w.Close()
 	os.Stdout = w
 	p := &api.Project{Slug: "blah"}
-	err := ProjectSync(p)
+	err := ProjectSync(context.Background(), p)
 	os.Stdout = old
 	if err != nil {
 		t.Errorf("SyncProject failed with err: %s", err)
@@ -157,7 +279,7 @@ func TestUpdateProject(t *testing.T) {
 	monitoredBool := false
 	monitored = &monitoredBool
 	p := &api.Project{Slug: "blah"}
-	err := ProjectUpdate(p, name, desc, monitored)
+	err := ProjectUpdate(context.Background(), p, name, desc, monitored)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -174,7 +296,7 @@ func TestUpdateProject(t *testing.T) {
 
 func TestUpdateProjectWithNoParams(t *testing.T) {
 	p := &api.Project{Slug: "blah"}
-	err := ProjectUpdate(p, nil, nil, nil)
+	err := ProjectUpdate(context.Background(), p, nil, nil, nil)
 	if err.Error() != "Please specify at least one thing to update (name, desc, or monitored" {
 		t.Errorf("Expected error to be 'Please specify at least one thing to update (name, desc, or monitored', got %s\n", err)
 	}
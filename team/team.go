@@ -0,0 +1,92 @@
+package team
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/heroku/hk/term"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Lambda to be overriden in tests
+var isTerminal = func() bool {
+	return term.IsTerminal(os.Stdin)
+}
+
+// List the teams of the current user
+func ListTeams(ctx context.Context) error {
+	if err := api.Require(api.APIImpl, api.FeatureTeams); err != nil {
+		return err
+	}
+	teams, err := api.APIImpl.UserTeams(ctx)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Slug", "Owner"})
+	for _, team := range teams {
+		table.Append([]string{team.Slug, team.Owner.Name})
+	}
+	table.Render()
+	return nil
+}
+
+// Return the team to create a project in: the team with the given slug if
+// not empty, the only team of the current user, or the team picked by the
+// user (reading the choice from scanner) when attached to a terminal.
+// nil is returned if the API has no teams (v1).
+func Select(ctx context.Context, slug string, scanner *bufio.Scanner) (*api.Team, error) {
+	if !api.APIImpl.Supports(api.FeatureTeams) {
+		if slug != "" {
+			return nil, api.Require(api.APIImpl, api.FeatureTeams)
+		}
+		return nil, nil
+	}
+	if slug != "" {
+		return &api.Team{Slug: slug}, nil
+	}
+
+	teams, err := api.APIImpl.UserTeams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(teams) == 0:
+		return nil, errors.New("Current user has no team !")
+	case len(teams) == 1:
+		return &teams[0], nil
+	case !isTerminal():
+		return nil, fmt.Errorf("You belong to several teams, please choose one with --team: %s", strings.Join(slugs(teams), ", "))
+	}
+
+	fmt.Println("Choose a team for the project:")
+	for i, team := range teams {
+		fmt.Printf("  %d) %s (%s)\n", i+1, team.Slug, team.Owner.Name)
+	}
+	fmt.Printf("Enter a number [1]: ")
+	scanner.Scan()
+	choice := strings.TrimSpace(scanner.Text())
+	if choice == "" {
+		return &teams[0], nil
+	}
+	i, err := strconv.Atoi(choice)
+	if err != nil || i < 1 || i > len(teams) {
+		return nil, fmt.Errorf("Invalid team number: %s", choice)
+	}
+	return &teams[i-1], nil
+}
+
+func slugs(teams []api.Team) []string {
+	slugs := []string{}
+	for _, team := range teams {
+		slugs = append(slugs, team.Slug)
+	}
+	return slugs
+}
@@ -0,0 +1,83 @@
+package team
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gemnasium/toolbelt/api"
+	"github.com/gemnasium/toolbelt/api/apitest"
+	"github.com/gemnasium/toolbelt/config/configtest"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(configtest.Run(m))
+}
+
+func TestSelect(t *testing.T) {
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+	srv.Teams = append(srv.Teams, api.V2Team{Slug: "justice-league", Owner: api.V2User{Name: "Clark", Email: "clark@example.com"}})
+	api.APIImpl = api.NewAPIv2(srv.URL, srv.APIKey)
+
+	orgIsTerminal := isTerminal
+	defer func() { isTerminal = orgIsTerminal }()
+
+	tests := []struct {
+		name     string
+		slug     string
+		terminal bool
+		input    string
+		expected string
+		err      string
+	}{
+		{name: "slug", slug: "justice-league", expected: "justice-league"},
+		{name: "picked", terminal: true, input: "2\n", expected: "justice-league"},
+		{name: "default choice", terminal: true, input: "\n", expected: apitest.DefaultTeam},
+		{name: "invalid choice", terminal: true, input: "3\n", err: "Invalid team number: 3"},
+		{name: "not a terminal", err: "You belong to several teams, please choose one with --team: batcave, justice-league"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isTerminal = func() bool { return tt.terminal }
+			team, err := Select(context.Background(), tt.slug, bufio.NewScanner(strings.NewReader(tt.input)))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if team.Slug != tt.expected {
+				t.Errorf("Expected team %s, got %s", tt.expected, team.Slug)
+			}
+		})
+	}
+}
+
+func TestSelectSingleTeam(t *testing.T) {
+	srv := apitest.NewServer(2)
+	defer srv.Close()
+	api.APIImpl = api.NewAPIv2(srv.URL, srv.APIKey)
+	team, err := Select(context.Background(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.Slug != apitest.DefaultTeam {
+		t.Errorf("Expected team %s, got %s", apitest.DefaultTeam, team.Slug)
+	}
+}
+
+func TestSelectV1(t *testing.T) {
+	api.APIImpl = api.NewAPIv1("https://example.com", "")
+	if team, err := Select(context.Background(), "", nil); team != nil || err != nil {
+		t.Errorf("Expected no team with API v1, got %v, %v", team, err)
+	}
+	if _, err := Select(context.Background(), "batcave", nil); err == nil {
+		t.Error("Expected --team to fail with API v1")
+	}
+}
@@ -41,8 +41,12 @@ func StatusDots(status string) string {
 }
 
 // return the current commit sha, using git
-// If the env var "REVISION" is specified, its value is returned directly
+// If a revision is given with --revision, or with the env var "REVISION",
+// its value is returned directly
 func GetCurrentRevision() string {
+	if config.Revision != "" {
+		return config.Revision
+	}
 	if envRevision := os.Getenv(config.ENV_REVISION); envRevision != "" {
 		return envRevision
 	}
@@ -66,6 +70,27 @@ func GetCurrentBranch() string {
 	return strings.TrimSpace(string(out))
 }
 
+// Return the sha of the commit rev refers to (ex: HEAD~1, v1.2.0), using git
+func ResolveRevision(rev string) (string, error) {
+	return ResolveRevisionIn("", rev)
+}
+
+// Return the sha of the commit rev refers to, in the git repository of dir
+// ("" for the current directory)
+func ResolveRevisionIn(dir, rev string) (string, error) {
+	// It would be parsed as an option
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("Unknown revision: %s", rev)
+	}
+	cmd := exec.Command(GitPath(), "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Unknown revision: %s", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 // Lookup for "git" in $PATH
 func GitPath() string {
 	path, _ := exec.LookPath("git")
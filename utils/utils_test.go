@@ -20,3 +20,12 @@ func testStatusDot(t *testing.T) {
 	}
 
 }
+
+func TestResolveRevision(t *testing.T) {
+	// Revisions that git would parse as options are rejected
+	for _, rev := range []string{"", "--all", "-h"} {
+		if sha, err := ResolveRevision(rev); err == nil {
+			t.Errorf("Expected %q to be rejected, got %s", rev, sha)
+		}
+	}
+}